@@ -0,0 +1,476 @@
+// +dl zh-cn
+/*
+  admin 提供 net/http Handler, 查看和运行时修改已注册的 Logger 和 Loggers.
+
+	http.Handle("/debug/log/", http.StripPrefix("/debug/log", admin.New()))
+
+  GET /          列出所有已注册的 Logger 和 Loggers.
+  GET /name      查看 name 的设置.
+  PUT /name      修改 name 的设置, POST 相同. 参数来自 query, form 或者 JSON body:
+
+	level   级别名称, 比如 debug, D 或者 [D].
+	flags   逗号分隔的 flags 名称, 替换全部 flags. 比如 date,time,shortfile.
+	modes   逗号分隔的 mode 名称. 带 "+", "-" 前缀的设置, 清除该 mode,
+	        否则替换全部 modes. 比如 +equal,-none_name.
+	        query 和 form 中的 "+" 应编码为 %2B, 未编码的 "+" 被解码为空格,
+	        所以以空格开头的 mode 名称按 "+" 前缀处理.
+	prefix  前缀.
+	ttl     临时修改的有效时间, 比如 10m. 到期后恢复被修改的设置,
+	        修改前从祖先继承的设置恢复继承, 见 log.Inherit.
+	        没有 ttl 的修改是永久的, 到期时不恢复它修改的设置, 其它临时修改仍然到期.
+
+  Loggers 的修改作用于其中所有的 Logger.
+*/
+// +dl
+
+// Package admin provides the net/http handler to inspect and change registered loggers.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/typepress/log"
+)
+
+var flagNames = []struct {
+	name string
+	flag int
+}{
+	{"date", log.Ldate},
+	{"time", log.Ltime},
+	{"microseconds", log.Lmicroseconds},
+	{"longfile", log.Llongfile},
+	{"shortfile", log.Lshortfile},
+}
+
+var modeNames = []struct {
+	name string
+	mode int
+}{
+	{"equal", log.MODE_EQUAL},
+	{"recover", log.MODE_RECOVER},
+	{"none_name", log.MODE_NONE_NAME},
+	{"none_eor", log.MODE_NONE_EOR},
+	{"dont_exit", log.MODE_DONT_EXIT},
+	{"dont_panic", log.MODE_DONT_PANIC},
+	{"json", log.MODE_JSON},
+	{"logfmt", log.MODE_LOGFMT},
+}
+
+// Setting is the JSON form of the settings of Logger.
+type Setting struct {
+	Name    string     `json:"name,omitempty"`
+	Level   string     `json:"level"`
+	Flags   []string   `json:"flags"`
+	Modes   []string   `json:"modes"`
+	Prefix  string     `json:"prefix"`
+	Expires *time.Time `json:"expires,omitempty"` // the end of temporary override
+	Loggers []Setting  `json:"loggers,omitempty"` // the members of Loggers
+}
+
+// change is the parameters of PUT and POST.
+type change struct {
+	Level  *string `json:"level"`
+	Flags  *string `json:"flags"`
+	Modes  *string `json:"modes"`
+	Prefix *string `json:"prefix"`
+	TTL    string  `json:"ttl"`
+}
+
+// snapshot saves the settings of a Logger.
+type snapshot struct {
+	l      log.Logger
+	level  int
+	flags  int
+	modes  []int
+	prefix string
+	owns   int // the log.INHERIT_* settings owned by l, the others are inherited
+}
+
+type override struct {
+	timer   *time.Timer
+	expires time.Time
+	saved   []snapshot
+	changed int // the log.INHERIT_* settings changed by the overrides
+}
+
+// Handler is the http.Handler of registered loggers.
+type Handler struct {
+	mu        sync.Mutex
+	overrides map[string]*override
+}
+
+// New returns Handler.
+func New() *Handler {
+	return &Handler{overrides: map[string]*override{}}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(r.URL.Path, "/")
+	switch r.Method {
+	case "GET", "HEAD":
+		if len(name) == 0 {
+			settings := []Setting{}
+			for _, name := range log.Names() {
+				if s, ok := h.setting(name); ok {
+					settings = append(settings, s)
+				}
+			}
+			writeJSON(w, http.StatusOK, settings)
+			return
+		}
+		h.get(w, name)
+	case "PUT", "POST":
+		if len(name) == 0 {
+			http.Error(w, "missing logger name", http.StatusBadRequest)
+			return
+		}
+		c, err := parseChange(r)
+		if err == nil {
+			err = h.apply(name, c)
+		}
+		if err == errNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.get(w, name)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) get(w http.ResponseWriter, name string) {
+	s, ok := h.setting(name)
+	if !ok {
+		http.Error(w, "logger not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+var errNotFound = errors.New("logger not found")
+
+// loggers returns the registered Logger of name, or the members of registered Loggers.
+func loggers(name string) ([]log.Logger, bool, error) {
+	if l := log.Lookup(name); l != nil {
+		return []log.Logger{l}, false, nil
+	}
+	if m := log.LookupLoggers(name); m != nil {
+		return m.Loggers(), true, nil
+	}
+	return nil, false, errNotFound
+}
+
+func (h *Handler) setting(name string) (Setting, bool) {
+	ls, multi, err := loggers(name)
+	if err != nil {
+		return Setting{}, false
+	}
+	var s Setting
+	if multi {
+		s.Loggers = []Setting{}
+		for _, l := range ls {
+			if l != nil {
+				s.Loggers = append(s.Loggers, settingOf(l))
+			}
+		}
+	} else {
+		s = settingOf(ls[0])
+	}
+	s.Name = name
+
+	h.mu.Lock()
+	if o := h.overrides[name]; o != nil {
+		expires := o.expires
+		s.Expires = &expires
+	}
+	h.mu.Unlock()
+	return s, true
+}
+
+func settingOf(l log.Logger) Setting {
+	s := Setting{
+		Level:  log.LevelName(l.Level()),
+		Flags:  []string{},
+		Modes:  []string{},
+		Prefix: l.Prefix(),
+	}
+	flags := l.Flags()
+	for _, f := range flagNames {
+		if flags&f.flag != 0 {
+			s.Flags = append(s.Flags, f.name)
+		}
+	}
+	for _, m := range modeNames {
+		if l.HasMode(m.mode) {
+			s.Modes = append(s.Modes, m.name)
+		}
+	}
+	return s
+}
+
+func parseChange(r *http.Request) (c change, err error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err = json.NewDecoder(r.Body).Decode(&c)
+		return
+	}
+	if err = r.ParseForm(); err != nil {
+		return
+	}
+	value := func(key string) *string {
+		if _, ok := r.Form[key]; !ok {
+			return nil
+		}
+		v := r.Form.Get(key)
+		return &v
+	}
+	c.Level, c.Flags, c.Modes, c.Prefix = value("level"), value("flags"), value("modes"), value("prefix")
+	c.TTL = r.Form.Get("ttl")
+	if c.Modes != nil {
+		modes := formModes(*c.Modes)
+		c.Modes = &modes
+	}
+	return
+}
+
+// formModes restores the "+" prefix of modes in the query or form, which is decoded as the space.
+func formModes(s string) string {
+	names := strings.Split(s, ",")
+	for i, name := range names {
+		if strings.HasPrefix(name, " ") {
+			names[i] = "+" + strings.TrimLeft(name, " ")
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func (h *Handler) apply(name string, c change) error {
+	ls, _, err := loggers(name)
+	if err != nil {
+		return err
+	}
+
+	level, flags := 0, -1
+	if c.Level != nil {
+		if level, err = log.ParseLevel(*c.Level); err != nil {
+			return err
+		}
+	}
+	if c.Flags != nil {
+		if flags, err = parseFlags(*c.Flags); err != nil {
+			return err
+		}
+	}
+	var replace bool
+	var set, clear []int
+	if c.Modes != nil {
+		if replace, set, clear, err = parseModes(*c.Modes); err != nil {
+			return err
+		}
+	}
+	var ttl time.Duration
+	if len(c.TTL) != 0 {
+		if ttl, err = time.ParseDuration(c.TTL); err != nil {
+			return err
+		}
+		if ttl <= 0 {
+			return errors.New("ttl must be positive")
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	o := h.overrides[name]
+	if ttl != 0 {
+		// keep the settings before the first override.
+		if o == nil {
+			o = &override{saved: save(ls)}
+		} else {
+			o.timer.Stop()
+		}
+		o.changed |= c.settings()
+		o.expires = time.Now().Add(ttl)
+		o.timer = time.AfterFunc(ttl, func() { h.expire(name, o) })
+		h.overrides[name] = o
+	} else if o != nil {
+		// the permanent change is not reverted, the other overrides still expire.
+		if o.changed &^= c.settings(); o.changed == 0 {
+			o.timer.Stop()
+			delete(h.overrides, name)
+		}
+	}
+
+	for _, l := range ls {
+		if l == nil {
+			continue
+		}
+		if c.Level != nil {
+			l.SetLevel(level)
+		}
+		if c.Flags != nil {
+			l.SetFlags(flags)
+		}
+		if c.Modes != nil {
+			if replace {
+				l.ClearModes(allModes()...)
+			}
+			l.ClearModes(clear...)
+			l.SetModes(set...)
+		}
+		if c.Prefix != nil {
+			l.SetPrefix(*c.Prefix)
+		}
+	}
+	return nil
+}
+
+// expire restores the settings saved by o.
+func (h *Handler) expire(name string, o *override) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.overrides[name] != o {
+		return
+	}
+	delete(h.overrides, name)
+	for _, s := range o.saved {
+		s.restore(o.changed)
+	}
+}
+
+// settings returns the log.INHERIT_* settings changed by c.
+func (c change) settings() (bits int) {
+	if c.Level != nil {
+		bits |= log.INHERIT_LEVEL
+	}
+	if c.Flags != nil {
+		bits |= log.INHERIT_FLAGS
+	}
+	if c.Modes != nil {
+		bits |= log.INHERIT_MODES
+	}
+	if c.Prefix != nil {
+		bits |= log.INHERIT_PREFIX
+	}
+	return
+}
+
+// restore restores the changed settings, the inherited settings are inherited again.
+func (s snapshot) restore(changed int) {
+	log.Inherit(s.l, changed&^s.owns)
+	changed &= s.owns
+	if changed&log.INHERIT_LEVEL != 0 {
+		s.l.SetLevel(s.level)
+	}
+	if changed&log.INHERIT_FLAGS != 0 {
+		s.l.SetFlags(s.flags)
+	}
+	if changed&log.INHERIT_MODES != 0 {
+		s.l.ClearModes(allModes()...)
+		s.l.SetModes(s.modes...)
+	}
+	if changed&log.INHERIT_PREFIX != 0 {
+		s.l.SetPrefix(s.prefix)
+	}
+}
+
+func save(ls []log.Logger) []snapshot {
+	saved := make([]snapshot, 0, len(ls))
+	for _, l := range ls {
+		if l == nil {
+			continue
+		}
+		s := snapshot{l: l, level: l.Level(), flags: l.Flags(), prefix: l.Prefix()}
+		for _, bit := range []int{log.INHERIT_LEVEL, log.INHERIT_FLAGS, log.INHERIT_MODES, log.INHERIT_PREFIX} {
+			if log.Owns(l, bit) {
+				s.owns |= bit
+			}
+		}
+		for _, m := range modeNames {
+			if l.HasMode(m.mode) {
+				s.modes = append(s.modes, m.mode)
+			}
+		}
+		saved = append(saved, s)
+	}
+	return saved
+}
+
+func allModes() []int {
+	modes := make([]int, len(modeNames))
+	for i, m := range modeNames {
+		modes[i] = m.mode
+	}
+	return modes
+}
+
+func parseFlags(s string) (flags int, err error) {
+	for _, name := range split(s) {
+		found := false
+		for _, f := range flagNames {
+			if strings.EqualFold(name, f.name) {
+				flags |= f.flag
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, errors.New("unknown flag " + name)
+		}
+	}
+	return
+}
+
+// parseModes returns replace true if any mode has no "+" or "-" prefix.
+func parseModes(s string) (replace bool, set, clear []int, err error) {
+	for _, name := range split(s) {
+		op := name[0]
+		if op == '+' || op == '-' {
+			name = name[1:]
+		} else {
+			replace = true
+		}
+		mode := 0
+		for _, m := range modeNames {
+			if strings.EqualFold(name, m.name) {
+				mode = m.mode
+				break
+			}
+		}
+		if mode == 0 {
+			return false, nil, nil, errors.New("unknown mode " + name)
+		}
+		if op == '-' {
+			clear = append(clear, mode)
+		} else {
+			set = append(set, mode)
+		}
+	}
+	return
+}
+
+func split(s string) (names []string) {
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) != 0 {
+			names = append(names, name)
+		}
+	}
+	return
+}
@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/typepress/log"
+)
+
+func do(t *testing.T, h http.Handler, method, url, body string) (int, Setting) {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if len(body) != 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	var s Setting
+	if w.Code == http.StatusOK {
+		json.Unmarshal(w.Body.Bytes(), &s)
+	}
+	return w.Code, s
+}
+
+func TestHandler(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	l := log.New(w, "db", log.LstdFlags, log.LError)
+	log.Register("db", l)
+	log.RegisterLoggers("all", log.Multi(l, log.New(w, "", 0)))
+	defer log.Unregister("db")
+	defer log.Unregister("all")
+
+	h := New()
+	code, s := do(t, h, "GET", "/db", "")
+	if code != 200 || s.Level != "error" || len(s.Flags) != 2 || s.Prefix != "db" {
+		t.Fatalf("unexpected: %d %#v", code, s)
+	}
+
+	code, s = do(t, h, "PUT", "/db?level=debug&modes=%2Bequal&flags=shortfile&ttl=50ms", "")
+	if code != 200 || s.Level != "debug" || s.Modes[0] != "equal" || s.Flags[0] != "shortfile" ||
+		s.Expires == nil {
+		t.Fatalf("unexpected: %d %#v", code, s)
+	}
+	if l.Level() != log.LDebug || !l.HasMode(log.MODE_EQUAL) {
+		t.Error("PUT failed")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if l.Level() != log.LError || l.HasMode(log.MODE_EQUAL) || l.Flags() != log.LstdFlags {
+		t.Error("override does not expire")
+	}
+
+	// the unencoded "+" is decoded as the space
+	l.SetModes(log.MODE_RECOVER)
+	code, s = do(t, h, "PUT", "/db?modes=+equal,+none_name&ttl=50ms", "")
+	if code != 200 || strings.Join(s.Modes, ",") != "equal,recover,none_name" {
+		t.Errorf("want modes added, but got: %d %v", code, s.Modes)
+	}
+	time.Sleep(100 * time.Millisecond)
+	l.ClearModes(log.MODE_RECOVER)
+
+	code, s = do(t, h, "POST", "/all", `{"level":"info","prefix":"x"}`)
+	if code != 200 || len(s.Loggers) != 2 || s.Loggers[1].Level != "info" || s.Loggers[1].Prefix != "x" {
+		t.Fatalf("unexpected: %d %#v", code, s)
+	}
+
+	if code, _ = do(t, h, "PUT", "/none?level=debug", ""); code != 404 {
+		t.Errorf("want 404, but got: %d", code)
+	}
+	if code, _ = do(t, h, "PUT", "/db?level=what", ""); code != 400 {
+		t.Errorf("want 400, but got: %d", code)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var list []Setting
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 2 || list[0].Name != "all" {
+		t.Errorf("unexpected: %v %s", err, rec.Body.String())
+	}
+}
+
+func TestTTLInherit(t *testing.T) {
+	parent, child := log.Get("admintest"), log.Get("admintest.child")
+	log.Register("admintest.child", child)
+	t.Cleanup(func() {
+		log.Unregister("root")
+		log.Unregister("admintest")
+		log.Unregister("admintest.child")
+	})
+	parent.SetOutput(bytes.NewBuffer(nil))
+	parent.SetLevel(log.LError)
+	child.SetPrefix("child")
+
+	h := New()
+	if code, _ := do(t, h, "PUT", "/admintest.child?level=debug&prefix=tmp&ttl=30ms", ""); code != 200 {
+		t.Fatalf("unexpected: %d", code)
+	}
+	time.Sleep(80 * time.Millisecond)
+	if child.Level() != log.LError || child.Prefix() != "child" {
+		t.Fatalf("override does not expire: %d %q", child.Level(), child.Prefix())
+	}
+
+	// the level is inherited again, the own prefix is restored
+	parent.SetLevel(log.LInfo)
+	if child.Level() != log.LInfo || log.Owns(child, log.INHERIT_LEVEL) || !log.Owns(child, log.INHERIT_PREFIX) {
+		t.Errorf("the level is pinned by the expired override: %d", child.Level())
+	}
+}
+
+func TestTTLPermanent(t *testing.T) {
+	l := log.New(bytes.NewBuffer(nil), "db", 0, log.LError)
+	log.Register("ttltest", l)
+	t.Cleanup(func() { log.Unregister("ttltest") })
+
+	h := New()
+	if code, _ := do(t, h, "PUT", "/ttltest?level=debug&ttl=30ms", ""); code != 200 {
+		t.Fatalf("unexpected: %d", code)
+	}
+	if code, s := do(t, h, "PUT", "/ttltest?prefix=new", ""); code != 200 || s.Expires == nil {
+		t.Fatalf("the pending revert is canceled: %d %#v", code, s)
+	}
+	time.Sleep(80 * time.Millisecond)
+	if l.Level() != log.LError || l.Prefix() != "new" {
+		t.Errorf("want the level reverted and the prefix kept, but got %d %q", l.Level(), l.Prefix())
+	}
+
+	// the permanent change of the same setting cancels the revert
+	do(t, h, "PUT", "/ttltest?level=debug&ttl=30ms", "")
+	if code, s := do(t, h, "PUT", "/ttltest?level=info", ""); code != 200 || s.Expires != nil {
+		t.Fatalf("the revert is not canceled: %d %#v", code, s)
+	}
+	time.Sleep(80 * time.Millisecond)
+	if l.Level() != log.LInfo {
+		t.Errorf("the permanent level is reverted: %d", l.Level())
+	}
+}
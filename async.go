@@ -0,0 +1,375 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// +dl zh-cn
+/*
+  Async 队列满时的溢出策略常量.
+  OVERFLOW_BLOCK 阻塞等待, 不丢弃记录, 缺省值.
+  OVERFLOW_DROP_NEWEST 丢弃新记录.
+  OVERFLOW_DROP_OLDEST 丢弃队列中最旧的记录.
+  OVERFLOW_SAMPLE 每 AsyncSets.Sample 条溢出记录阻塞写入一条, 其余丢弃.
+*/
+// +dl
+
+// overflow policy constants for Async.
+const (
+	OVERFLOW_BLOCK       = iota // block the caller, default
+	OVERFLOW_DROP_NEWEST        // drop the new record
+	OVERFLOW_DROP_OLDEST        // drop the oldest record in the queue
+	OVERFLOW_SAMPLE             // keep one of every Sample records
+)
+
+var (
+	ErrClosed  = errors.New("log: writer closed")
+	ErrTimeout = errors.New("log: timeout")
+)
+
+// +dl zh-cn
+// AsyncSets 是 Async 的配置参数. 属性值为 0 时采用缺省值:
+//
+//   Size     1024 条记录
+//   Overflow OVERFLOW_BLOCK
+//   Sample   10
+//   Timeout  5000 毫秒, Flush, Close 等待队列写完的时间
+// +dl
+
+// AsyncSets for Async
+type AsyncSets struct {
+	Size, Overflow, Sample, Timeout int
+}
+
+// +dl zh-cn
+// AsyncWriter 是 Async 返回的 io.WriteCloser.
+// +dl
+
+// AsyncWriter is the io.WriteCloser returned by Async.
+type AsyncWriter interface {
+	io.WriteCloser
+
+	// +dl zh-cn
+	// Flush 等待队列中的记录全部写完, 超时返回 ErrTimeout.
+	// 否则返回上次 Flush 以来写入时发生的第一个错误.
+	// +dl
+
+	// Flush waits until the queued records are written.
+	Flush() error
+
+	// Dropped returns the number of dropped records.
+	Dropped() uint64
+
+	// Errors returns the number of failed writes.
+	Errors() uint64
+}
+
+// states of the record in the queue, the EOR written after the record is kept with it.
+const (
+	_item_queued  = iota // the record is not written
+	_item_written        // the record is written, the EOR may follow
+	_item_eor            // the EOR follows the record
+	_item_done           // the record and its EOR are written, or not a record
+)
+
+type asyncItem struct {
+	p     []byte
+	state int32      // one of _item_*, updated atomically
+	flush chan error // not nil for flush marker
+}
+
+type async struct {
+	w       io.Writer
+	queue   chan *asyncItem
+	wake    chan struct{} // the EOR follows the record written by the writer goroutine
+	done    chan struct{}
+	exited  chan struct{}
+	policy  int
+	sample  uint64
+	timeout time.Duration
+
+	mu        sync.Mutex // serializes Write
+	overflows uint64     // protected by mu
+	skipEOR   bool       // protected by mu, the record before EOR was dropped
+	last      *asyncItem // protected by mu, the record queued by the last Write
+	prev      *asyncItem // the last record written, used by the writer goroutine only
+
+	closed  int32 // set under mu, so Write never queues after the writer goroutine exits
+	dropped uint64
+	errors  uint64
+	err     error // first error since last Flush, used by the writer goroutine only
+	once    sync.Once
+}
+
+// +dl zh-cn
+/*
+  Async 包装 io.Writer, 返回 AsyncWriter. 写入的记录被复制到有界队列,
+  由后台 goroutine 写入 w, 调用者不再等待 w.Write, 比如 smtp.Smtp 的网络发送.
+  Output 在每条记录后写的 EOR 与记录作为一项排队, 一起被保留或丢弃, 不计入溢出.
+  Close 先 Flush, 然后关闭 w, 如果 w 是 io.Closer.
+*/
+// +dl
+
+// Async wrapper io.Writer, returns AsyncWriter writes to w in background goroutine.
+func Async(w io.Writer, sets AsyncSets) AsyncWriter {
+	if w == nil {
+		return nil
+	}
+	if sets.Size <= 0 {
+		sets.Size = 1024
+	}
+	if sets.Sample <= 0 {
+		sets.Sample = 10
+	}
+	if sets.Timeout <= 0 {
+		sets.Timeout = 5000
+	}
+	a := &async{
+		w:       w,
+		queue:   make(chan *asyncItem, sets.Size),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+		policy:  sets.Overflow,
+		sample:  uint64(sets.Sample),
+		timeout: time.Duration(sets.Timeout) * time.Millisecond,
+	}
+	go a.loop()
+	return a
+}
+
+func (a *async) loop() {
+	defer close(a.exited)
+	for {
+		select {
+		case it := <-a.queue:
+			a.write(it)
+		case <-a.wake:
+			a.finish(false)
+		case <-a.done:
+			for {
+				select {
+				case it := <-a.queue:
+					a.write(it)
+				default:
+					a.finish(true)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *async) write(it *asyncItem) {
+	a.finish(true) // the EOR of a.prev arrives before the later items
+	if it.flush != nil {
+		it.flush <- a.err
+		a.err = nil
+		return
+	}
+	a.output(it.p)
+	if atomic.CompareAndSwapInt32(&it.state, _item_queued, _item_written) {
+		a.prev = it
+	} else if atomic.CompareAndSwapInt32(&it.state, _item_eor, _item_done) {
+		a.output(endOfRecord)
+	}
+}
+
+// finish writes the EOR follows a.prev. If final is true, the later EOR of a.prev is
+// queued alone by Write.
+func (a *async) finish(final bool) {
+	if a.prev == nil {
+		return
+	}
+	state := int32(_item_eor)
+	if final {
+		state = atomic.SwapInt32(&a.prev.state, _item_done)
+	} else if !atomic.CompareAndSwapInt32(&a.prev.state, _item_eor, _item_done) {
+		return
+	}
+	a.prev = nil
+	if state == _item_eor {
+		a.output(endOfRecord)
+	}
+}
+
+func (a *async) output(p []byte) {
+	_, err := a.w.Write(p)
+	if err != nil {
+		atomic.AddUint64(&a.errors, 1)
+		if a.err == nil {
+			a.err = err
+		}
+	}
+}
+
+func (a *async) Write(p []byte) (n int, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if atomic.LoadInt32(&a.closed) != 0 {
+		return 0, ErrClosed
+	}
+
+	if p != nil && len(p) == 0 {
+		// EOR follows the last record
+		last, skip := a.last, a.skipEOR
+		a.last, a.skipEOR = nil, false
+		if skip {
+			return 0, nil // the record was dropped
+		}
+		if last != nil {
+			if atomic.CompareAndSwapInt32(&last.state, _item_queued, _item_eor) {
+				return 0, nil
+			}
+			if atomic.CompareAndSwapInt32(&last.state, _item_written, _item_eor) {
+				select {
+				case a.wake <- struct{}{}:
+				default:
+				}
+				return 0, nil
+			}
+		}
+		a.send(&asyncItem{p: p, state: _item_done})
+		return 0, nil
+	}
+
+	a.last, a.skipEOR = nil, false
+	if p == nil {
+		a.send(&asyncItem{state: _item_done})
+		return 0, nil
+	}
+	it := &asyncItem{p: append(make([]byte, 0, len(p)), p...)}
+	if !a.put(it) {
+		atomic.AddUint64(&a.dropped, 1)
+		a.skipEOR = true
+		return len(p), nil
+	}
+	a.last = it
+	return len(p), nil
+}
+
+// send sends the item which is never dropped, such as the EOR of a written record.
+// a.mu must be locked.
+func (a *async) send(it *asyncItem) {
+	select {
+	case a.queue <- it:
+	case <-a.done:
+	}
+}
+
+// put sends the record it to queue by policy, returns false if it is dropped. a.mu must be locked.
+func (a *async) put(it *asyncItem) bool {
+	select {
+	case a.queue <- it:
+		return true
+	default:
+	}
+
+	switch a.policy {
+	case OVERFLOW_DROP_NEWEST:
+		return false
+	case OVERFLOW_DROP_OLDEST:
+		// the flush markers and the lone EORs are never dropped, they are queued again
+		// after it, so Flush returns after the records queued before it are written.
+		var markers []*asyncItem
+		for dropped := false; !dropped; {
+			select {
+			case old := <-a.queue:
+				if old.flush != nil || len(old.p) == 0 {
+					markers = append(markers, old)
+					continue
+				}
+				atomic.AddUint64(&a.dropped, 1)
+				dropped = true
+			default:
+				dropped = true // drained by the writer goroutine meanwhile
+			}
+		}
+		// a.done is not closed while a.mu is locked, the writer goroutine keeps draining.
+		a.queue <- it
+		for _, marker := range markers {
+			a.queue <- marker
+		}
+		return true
+	case OVERFLOW_SAMPLE:
+		a.overflows++
+		if a.overflows%a.sample != 1 && a.sample != 1 {
+			return false
+		}
+	}
+
+	select {
+	case a.queue <- it:
+		return true
+	case <-a.done:
+		return false
+	}
+}
+
+func (a *async) Flush() error {
+	if atomic.LoadInt32(&a.closed) != 0 {
+		return ErrClosed
+	}
+	return a.flush()
+}
+
+func (a *async) flush() error {
+	timer := time.NewTimer(a.timeout)
+	defer timer.Stop()
+
+	marker := &asyncItem{flush: make(chan error, 1), state: _item_done}
+	select {
+	case a.queue <- marker:
+	case <-a.done:
+		return ErrClosed
+	case <-timer.C:
+		return ErrTimeout
+	}
+
+	select {
+	case err := <-marker.flush:
+		return err
+	case <-timer.C:
+		return ErrTimeout
+	}
+}
+
+func (a *async) Close() (err error) {
+	err = ErrClosed
+	a.once.Do(func() {
+		err = a.flush()
+		a.mu.Lock()
+		atomic.StoreInt32(&a.closed, 1)
+		a.mu.Unlock()
+		close(a.done)
+
+		select {
+		case <-a.exited:
+		case <-time.After(a.timeout):
+			if err == nil {
+				err = ErrTimeout
+			}
+			return
+		}
+
+		if c, ok := a.w.(io.Closer); ok {
+			if e := c.Close(); err == nil {
+				err = e
+			}
+		}
+	})
+	return
+}
+
+func (a *async) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+func (a *async) Errors() uint64 {
+	return atomic.LoadUint64(&a.errors)
+}
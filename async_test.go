@@ -0,0 +1,185 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowWriter blocks Write until release is closed.
+type slowWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	release chan struct{}
+	closed  bool
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *slowWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestAsync(t *testing.T) {
+	sw := &slowWriter{release: make(chan struct{})}
+	a := Async(sw, AsyncSets{Size: 2, Overflow: OVERFLOW_DROP_NEWEST})
+	l := New(a, "", 0)
+
+	for i := 0; i < 10; i++ {
+		l.Infof("%d", i)
+	}
+	close(sw.release)
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if a.Dropped() == 0 || a.Dropped() >= 10 {
+		t.Errorf("unexpected dropped: %d", a.Dropped())
+	}
+	if lines := bytes.Count(sw.buf.Bytes(), []byte("\n")); uint64(lines)+a.Dropped() != 10 {
+		t.Errorf("lines: %d, dropped: %d", lines, a.Dropped())
+	}
+
+	l.Info("last")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !sw.closed || !bytes.HasSuffix(sw.buf.Bytes(), []byte(`[I] "last"`+"\n")) {
+		t.Errorf("unexpected: %v %q", sw.closed, sw.buf.String())
+	}
+	if _, err := a.Write([]byte("x")); err != ErrClosed {
+		t.Errorf("want ErrClosed, but got: %v", err)
+	}
+}
+
+func TestAsyncDropOldest(t *testing.T) {
+	sw := &slowWriter{release: make(chan struct{})}
+	a := Async(sw, AsyncSets{Size: 4, Overflow: OVERFLOW_DROP_OLDEST, Timeout: 100})
+	for i := 0; i < 100; i++ {
+		a.Write([]byte{'0' + byte(i%10), '\n'})
+	}
+	if err := a.Flush(); err != ErrTimeout {
+		t.Errorf("want ErrTimeout, but got: %v", err)
+	}
+	close(sw.release)
+	time.Sleep(10 * time.Millisecond)
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(sw.buf.Bytes(), []byte("9\n")) || a.Dropped() == 0 {
+		t.Errorf("unexpected: %d %q", a.Dropped(), sw.buf.String())
+	}
+}
+
+func TestAsyncDropOldestFlush(t *testing.T) {
+	sw := &slowWriter{release: make(chan struct{})}
+	a := Async(sw, AsyncSets{Size: 2, Overflow: OVERFLOW_DROP_OLDEST}).(*async)
+	a.Write([]byte("a"))
+	for len(a.queue) != 0 { // "a" is in the writer goroutine
+		time.Sleep(time.Millisecond)
+	}
+	flushed := make(chan error, 1)
+	go func() { flushed <- a.Flush() }()
+	for len(a.queue) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	a.Write([]byte("b")) // the queue is full
+	a.Write([]byte("c")) // drops "b", not the flush marker
+
+	select {
+	case err := <-flushed:
+		t.Fatalf("Flush returns %v before the records are written", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(sw.release)
+	if err := <-flushed; err != nil || sw.buf.String() != "ac" || a.Dropped() != 1 {
+		t.Errorf("unexpected: %v %q %d", err, sw.buf.String(), a.Dropped())
+	}
+	a.Close()
+}
+
+// countWriter counts the written records.
+type countWriter struct{ n int64 }
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(&w.n, 1)
+	return len(p), nil
+}
+
+func TestAsyncCloseRace(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		cw := &countWriter{}
+		a := Async(cw, AsyncSets{Size: 4})
+		var accepted int64
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					if _, err := a.Write([]byte("x")); err != nil {
+						return
+					}
+					atomic.AddInt64(&accepted, 1)
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+		wg.Wait()
+		if n := atomic.LoadInt64(&cw.n); n != accepted {
+			t.Fatalf("%d records accepted, but %d written", accepted, n)
+		}
+	}
+}
+
+// eorWriter records "R" for each record and "E" for each EOR slowly after release is closed.
+type eorWriter struct {
+	mu      sync.Mutex
+	seq     []byte
+	release chan struct{}
+}
+
+func (w *eorWriter) Write(p []byte) (int, error) {
+	<-w.release
+	time.Sleep(time.Millisecond)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(p) == 0 {
+		w.seq = append(w.seq, 'E')
+	} else {
+		w.seq = append(w.seq, 'R')
+	}
+	return len(p), nil
+}
+
+func TestAsyncEOR(t *testing.T) {
+	for _, policy := range []int{OVERFLOW_BLOCK, OVERFLOW_DROP_NEWEST, OVERFLOW_DROP_OLDEST, OVERFLOW_SAMPLE} {
+		w := &eorWriter{release: make(chan struct{})}
+		a := Async(w, AsyncSets{Size: 3, Overflow: policy, Sample: 2})
+		l := New(a, "", 0)
+		time.AfterFunc(20*time.Millisecond, func() { close(w.release) }) // the sampled records block
+		for i := 0; i < 20; i++ {
+			l.Info(i)
+		}
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+		seq := string(w.seq)
+		if records := strings.Count(seq, "R"); strings.Repeat("RE", records) != seq ||
+			uint64(records)+a.Dropped() != 20 ||
+			policy != OVERFLOW_BLOCK && a.Dropped() == 0 {
+			t.Errorf("policy %d: %q, dropped %d", policy, seq, a.Dropped())
+		}
+	}
+}
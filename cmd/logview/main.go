@@ -0,0 +1,546 @@
+// +dl zh-cn
+/*
+  logview 读取 file.File 生成的日志文件, 按时间顺序合并输出, 并支持过滤.
+
+  用法:
+
+	logview [flags] path...
+
+  path 可以是目录或者文件, 目录下所有符合 -naming 和 -layout 命名的文件都会被读取,
+  它们对应 file.Sets 的 Naming 和 Layout:
+
+	timestamp  prefix-20060102150405.000[.N].ext
+	numbered   name.ext, name.ext.N, N 越大越旧
+	dated      name.ext, name.ext.20060102150405.000[.N]
+
+  同一 File 的文件按写入的先后顺序读取, 当前文件 name.ext 最后, 不同 File 的日志按记录时间合并.
+  follow 模式下 numbered 和 dated 的当前文件被轮转后, 重新打开新的当前文件,
+  两次轮询之间多次轮转产生的中间文件不被读取.
+  File 压缩的文件, 比如 ".txt.gz", 被透明地解压读取.
+*/
+// +dl
+
+// Command logview merges, filters and prints the files written by file.File.
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/typepress/log"
+	"github.com/typepress/log/file"
+)
+
+var (
+	levels   = flag.String("level", "", "only levels in the comma separated list, e.g. E,A or error,alert")
+	minLevel = flag.String("min", "", "only levels at least as severe as this level")
+	since    = flag.String("since", "", "only records at or after this time")
+	until    = flag.String("until", "", "only records before this time")
+	prefix   = flag.String("prefix", "", "only records with this prefix")
+	caller   = flag.String("caller", "", "only records whose caller file contains this string or matches this glob")
+	output   = flag.String("o", "text", "output format: text, raw or json")
+	follow   = flag.Bool("f", false, "follow the files, and the new rotated files")
+	interval = flag.Duration("interval", time.Second, "poll interval of follow mode")
+	naming   = flag.String("naming", "timestamp", "naming scheme of the files: timestamp, numbered or dated")
+	layout   = flag.String("layout", file.DefaultLayout, "time layout in the file names")
+)
+
+// namings maps the -naming flag to file.Sets.Naming.
+var namings = map[string]int{
+	"timestamp": file.NAME_TIMESTAMP,
+	"numbered":  file.NAME_NUMBERED,
+	"dated":     file.NAME_DATED,
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] path...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := newFilter()
+	if err != nil {
+		fatal(err)
+	}
+
+	v := &viewer{filter: f, out: bufio.NewWriter(os.Stdout), paths: flag.Args()}
+	if err = v.scan(); err != nil {
+		fatal(err)
+	}
+	v.merge()
+	v.out.Flush()
+
+	for *follow {
+		time.Sleep(*interval)
+		if err = v.scan(); err != nil {
+			fatal(err)
+		}
+		v.tail()
+		v.out.Flush()
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "logview:", err)
+	os.Exit(1)
+}
+
+type filter struct {
+	levels       map[int]bool
+	min          int
+	since, until time.Time
+	prefix       string
+	caller       string
+	any          bool // any filter of record
+}
+
+func newFilter() (*filter, error) {
+	f := &filter{min: log.LDebug, prefix: *prefix, caller: *caller}
+	if len(*levels) != 0 {
+		f.levels = map[int]bool{}
+		for _, name := range strings.Split(*levels, ",") {
+			level, err := log.ParseLevel(name)
+			if err != nil {
+				return nil, err
+			}
+			f.levels[level] = true
+		}
+	}
+	if len(*minLevel) != 0 {
+		level, err := log.ParseLevel(*minLevel)
+		if err != nil {
+			return nil, err
+		}
+		f.min = level
+	}
+
+	var err error
+	if f.since, err = parseTime(*since); err != nil {
+		return nil, err
+	}
+	if f.until, err = parseTime(*until); err != nil {
+		return nil, err
+	}
+	f.any = f.levels != nil || f.min != log.LDebug || len(f.prefix) != 0 || len(f.caller) != 0
+	return f, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{
+		time.RFC3339Nano, "2006-01-02 15:04:05.000000", "2006-01-02 15:04:05",
+		"2006-01-02 15:04", "2006-01-02",
+	} {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// match reports whether e passes the filter.
+// the lines which are not records pass only if there is no record filter.
+func (f *filter) match(e *entry) bool {
+	if !f.since.IsZero() && e.time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !e.time.Before(f.until) {
+		return false
+	}
+	r := e.rec
+	if r == nil {
+		return !f.any
+	}
+	if f.levels != nil && !f.levels[r.Level] {
+		return false
+	}
+	if r.Level != log.LZero && r.Level < f.min {
+		return false
+	}
+	if len(f.prefix) != 0 && r.Prefix != f.prefix {
+		return false
+	}
+	if len(f.caller) != 0 && !matchCaller(f.caller, r.File) {
+		return false
+	}
+	return true
+}
+
+func matchCaller(pattern, file string) bool {
+	if len(file) == 0 {
+		return false
+	}
+	if !strings.ContainsAny(pattern, `*?[`) {
+		return strings.Contains(file, pattern)
+	}
+	if ok, _ := path.Match(pattern, file); ok {
+		return true
+	}
+	// match the trailing path elements, "db/*.go" matches "/src/app/db/pool.go".
+	n := strings.Count(pattern, "/") + 1
+	elems := strings.Split(file, "/")
+	if len(elems) > n {
+		elems = elems[len(elems)-n:]
+	}
+	ok, _ := path.Match(pattern, strings.Join(elems, "/"))
+	return ok
+}
+
+// entry is a line of log file.
+type entry struct {
+	line string
+	rec  *log.Record
+	time time.Time // time of rec, or the last known time of stream
+}
+
+// stream reads the files of the same prefix in order.
+type stream struct {
+	files   []logFile       // sorted by the order of writing
+	known   map[string]bool // names of files without the codec extension
+	pos     int             // index of the reading file
+	f       io.ReadCloser
+	r       *bufio.Reader
+	partial string // incomplete line at the end of file
+	reopen  bool   // the reading file is rotated
+	last    time.Time
+	head    *entry
+}
+
+// logFile is a file of stream.
+type logFile struct {
+	name string
+	file.Name
+}
+
+// add adds the new file, returns false if it is known.
+// The compressed file of a known file is known too, next opens it if the known file is removed.
+// After reading, the files older than the reading one are ignored, they are
+// renamed from the read files by the rotation of NAME_NUMBERED or NAME_DATED.
+func (s *stream) add(name string, n file.Name) bool {
+	plain := trimCodec(name)
+	if s.known[plain] {
+		return false
+	}
+	if s.known == nil {
+		s.known = map[string]bool{}
+	}
+	s.known[plain] = true
+	if i := s.pos; (i > 0 || s.r != nil) && len(s.files) != 0 {
+		if i == len(s.files) {
+			i--
+		}
+		if n.Before(s.files[i].Name) {
+			return false
+		}
+	}
+	s.files = append(s.files, logFile{name, n})
+	files := s.files[s.pos:]
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Before(files[j].Name) })
+	return true
+}
+
+// next returns the next complete line, returns nil if no more lines for now.
+// The incomplete line at the end of the last file is returned only if final is true.
+func (s *stream) next(final bool) (*entry, error) {
+	for {
+		if s.r == nil {
+			if s.pos >= len(s.files) {
+				return nil, nil
+			}
+			f, err := open(s.files[s.pos].name)
+			if os.IsNotExist(err) {
+				// neither the file nor its compressed file exists,
+				// e.g. it is removed by the retention of file.File.
+				s.pos++
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			s.f, s.r = f, bufio.NewReader(f)
+		}
+
+		line, err := s.r.ReadString('\n')
+		if err == nil {
+			line = s.partial + line
+			s.partial = ""
+			if len(strings.TrimSpace(line)) == 0 {
+				continue
+			}
+			return s.parse(strings.TrimRight(line, "\r\n")), nil
+		}
+		if err != io.EOF {
+			return nil, err
+		}
+		s.partial += line
+
+		// EOF, continue with the next file if there is,
+		// or reopen the current file of the same name if it is rotated.
+		// The rotated file is read to EOF again, it may be written before the rotation.
+		rotated := s.pos+1 >= len(s.files) && !final && (s.reopen || s.rotated())
+		if rotated && !s.reopen {
+			s.reopen = true
+			continue
+		}
+		if s.pos+1 >= len(s.files) && !rotated {
+			if final && len(s.partial) != 0 {
+				line, s.partial = s.partial, ""
+				return s.parse(strings.TrimRight(line, "\r")), nil
+			}
+			return nil, nil
+		}
+		s.f.Close()
+		s.f, s.r, s.reopen = nil, nil, false
+		if !rotated {
+			s.pos++
+		}
+		if len(s.partial) != 0 {
+			line, s.partial = s.partial, ""
+			return s.parse(line), nil
+		}
+	}
+}
+
+// rotated reports whether the name of the reading file refers to another file.
+func (s *stream) rotated() bool {
+	fd, ok := s.f.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		return false
+	}
+	now, err := os.Stat(s.files[s.pos].name)
+	return err == nil && !os.SameFile(fi, now)
+}
+
+func (s *stream) parse(line string) *entry {
+	e := &entry{line: line}
+	if rec, err := log.Parse(line); err == nil {
+		e.rec = rec
+		if !rec.Time.IsZero() {
+			s.last = rec.Time
+		}
+	}
+	e.time = s.last
+	return e
+}
+
+type viewer struct {
+	filter  *filter
+	out     *bufio.Writer
+	paths   []string
+	streams []*stream
+	byName  map[string]*stream // key is dir + file.Name.Key
+}
+
+// scan finds the log files in paths, adds the new files to streams.
+func (v *viewer) scan() error {
+	if v.byName == nil {
+		v.byName = map[string]*stream{}
+	}
+	scheme, ok := namings[*naming]
+	if !ok {
+		return fmt.Errorf("unknown naming %q", *naming)
+	}
+	for _, p := range v.paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			n, ok := file.ParseName(scheme, *layout, filepath.Base(p))
+			if !ok {
+				n = file.Name{Key: filepath.Base(p), Current: true}
+			}
+			v.add(p, n)
+			continue
+		}
+		names, err := filepath.Glob(filepath.Join(p, "*"))
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if n, ok := file.ParseName(scheme, *layout, filepath.Base(name)); ok {
+				v.add(name, n)
+			}
+		}
+	}
+	return nil
+}
+
+func (v *viewer) add(name string, n file.Name) {
+	key := filepath.Join(filepath.Dir(name), n.Key)
+	s := v.byName[key]
+	if s == nil {
+		s = &stream{}
+		v.byName[key] = s
+		v.streams = append(v.streams, s)
+	}
+	s.add(name, n)
+}
+
+// open opens the file of name, or the compressed file of name if name is
+// compressed and removed by file.File after it is found.
+func open(name string) (io.ReadCloser, error) {
+	f, err := file.Open(name)
+	if !os.IsNotExist(err) {
+		return f, err
+	}
+	plain := trimCodec(name)
+	names, _ := filepath.Glob(globEscape(plain) + ".*")
+	for _, compressed := range names {
+		if compressed != name && trimCodec(compressed) == plain {
+			return file.Open(compressed)
+		}
+	}
+	return nil, err
+}
+
+// globEscape escapes the meta characters of filepath.Match in name.
+func globEscape(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if strings.ContainsRune("*?[", r) {
+			b.WriteByte('[')
+			b.WriteRune(r)
+			b.WriteByte(']')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// trimCodec returns name without the extension of the compressed file.
+func trimCodec(name string) string {
+	if c := file.CodecOf(name); c != nil {
+		return strings.TrimSuffix(name, c.Ext())
+	}
+	return name
+}
+
+// merge prints all lines of streams in the order of time.
+func (v *viewer) merge() {
+	h := &entryHeap{}
+	for _, s := range v.streams {
+		v.push(h, s)
+	}
+	heap.Init(h)
+	for h.Len() != 0 {
+		s := (*h)[0]
+		v.print(s.head)
+		if !v.push(nil, s) {
+			heap.Pop(h)
+		} else {
+			heap.Fix(h, 0)
+		}
+	}
+}
+
+// push reads the next line of s to s.head, appends s to h if h is not nil.
+// The last line without newline waits for more data in follow mode.
+func (v *viewer) push(h *entryHeap, s *stream) bool {
+	e, err := s.next(!*follow)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "logview:", err)
+	}
+	s.head = e
+	if e == nil {
+		return false
+	}
+	if h != nil {
+		*h = append(*h, s)
+	}
+	return true
+}
+
+// tail prints the new lines of streams in follow mode.
+func (v *viewer) tail() {
+	for _, s := range v.streams {
+		for v.push(nil, s) {
+			v.print(s.head)
+		}
+	}
+}
+
+func (v *viewer) print(e *entry) {
+	if !v.filter.match(e) {
+		return
+	}
+	switch *output {
+	case "raw":
+		v.out.WriteString(e.line)
+		v.out.WriteByte('\n')
+	case "json":
+		r := e.rec
+		if r == nil {
+			r = &log.Record{Time: e.time, Level: log.LZero, Message: e.line}
+			if !e.time.IsZero() {
+				r.Flags = log.LstdFlags | log.Lmicroseconds
+			}
+		}
+		v.out.Write(log.JSONEncoder.Encode(nil, r))
+	default:
+		if e.rec == nil {
+			v.out.WriteString(e.line)
+			v.out.WriteByte('\n')
+			return
+		}
+		v.out.Write(text(e.rec))
+	}
+}
+
+// text returns the TextEncoder layout of r with the unquoted message.
+func text(r *log.Record) []byte {
+	header := *r
+	header.Message, header.Fields = "", nil
+	buf := log.TextEncoder.Encode(nil, &header)
+	buf = append(buf, r.Message...)
+	for _, f := range r.Fields {
+		buf = append(buf, ' ')
+		buf = append(buf, f.Key...)
+		buf = append(buf, '=')
+		if s, ok := f.Value.(string); ok {
+			buf = strconv.AppendQuote(buf, s)
+		} else {
+			buf = append(buf, fmt.Sprint(f.Value)...)
+		}
+	}
+	return append(buf, '\n')
+}
+
+// entryHeap orders streams by the time of head.
+type entryHeap []*stream
+
+func (h entryHeap) Len() int           { return len(h) }
+func (h entryHeap) Less(i, j int) bool { return h[i].head.time.Before(h[j].head.time) }
+func (h entryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *entryHeap) Push(x interface{}) {
+	*h = append(*h, x.(*stream))
+}
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/typepress/log/file"
+)
+
+// logs writes the files of two streams, app is rotated once, the last line has no newline.
+func logs(t *testing.T) string {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"app-20140218173000.000.txt": `app [I] 2014-02-18 17:30:01 <app/main.go:10> "start"` + "\n" +
+			`app [E] 2014-02-18 17:30:05 <app/db/pool.go:20> "dial" err="refused"` + "\n",
+		"app-20140218173010.000.txt": `app [R] 2014-02-18 17:30:10 <app/main.go:30> "slow"` + "\n" +
+			`app [D] 2014-02-18 17:30:20 <app/main.go:40> "partial"`,
+		"db-20140218173000.000.txt": `db [N] 2014-02-18 17:30:02 <db/server.go:5> "ready"` + "\n" +
+			"not a record\n" +
+			`db [A] 2014-02-18 17:30:15 <db/server.go:9> "disk full"` + "\n",
+		"other.txt": "ignored\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// view runs logview with the flags on paths, the flags are reset after.
+func view(t *testing.T, flags map[string]string, paths ...string) string {
+	t.Helper()
+	for name, value := range flags {
+		if err := flag.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+		defer flag.Set(name, flag.Lookup(name).DefValue)
+	}
+	f, err := newFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	v := &viewer{filter: f, out: bufio.NewWriter(&buf), paths: paths}
+	if err = v.scan(); err != nil {
+		t.Fatal(err)
+	}
+	v.merge()
+	v.out.Flush()
+	return buf.String()
+}
+
+// messages returns the first word of the message, or the line if it is not a record.
+func messages(out string) string {
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if i := strings.LastIndexByte(line, '>'); i != -1 {
+			line = strings.Fields(line[i+1:])[0]
+		}
+		msgs = append(msgs, strings.Trim(line, `"`))
+	}
+	return strings.Join(msgs, ",")
+}
+
+func TestMerge(t *testing.T) {
+	got := messages(view(t, map[string]string{"o": "raw"}, logs(t)))
+	if want := "start,ready,not a record,dial,slow,disk,partial"; got != want {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	dir := logs(t)
+	for _, c := range []struct {
+		flags map[string]string
+		want  string
+	}{
+		{map[string]string{"level": "E,A"}, "dial,disk"},
+		{map[string]string{"min": "N"}, "ready,dial,slow,disk"},
+		{map[string]string{"since": "2014-02-18 17:30:05", "until": "2014-02-18 17:30:15"}, "dial,slow"},
+		{map[string]string{"prefix": "db"}, "ready,disk"},
+		{map[string]string{"caller": "db/*.go"}, "ready,dial,disk"},
+		{map[string]string{"caller": "main.go"}, "start,slow,partial"},
+	} {
+		c.flags["o"] = "raw"
+		if got := messages(view(t, c.flags, dir)); got != c.want {
+			t.Errorf("%v: want %s, but got %s", c.flags, c.want, got)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	out := view(t, map[string]string{"o": "json", "prefix": "app", "level": "E"}, logs(t))
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &m); err != nil {
+		t.Fatal(err, out)
+	}
+	if m["level"] != "error" || m["prefix"] != "app" || m["msg"] != "dial" || m["err"] != "refused" ||
+		m["caller"] != "app/db/pool.go:20" || !strings.HasPrefix(m["time"].(string), "2014-02-18T17:30:05") {
+		t.Errorf("unexpected %v", m)
+	}
+}
+
+func TestFollowPartial(t *testing.T) {
+	s := &stream{}
+	n, _ := file.ParseName(file.NAME_TIMESTAMP, "", "app-20140218173010.000.txt")
+	s.add(filepath.Join(logs(t), "app-20140218173010.000.txt"), n)
+	for e, _ := s.next(false); e != nil; e, _ = s.next(false) {
+		if strings.Contains(e.line, "partial") {
+			t.Fatal("the incomplete line is returned in follow mode")
+		}
+	}
+	if e, _ := s.next(true); e == nil || e.rec == nil || e.rec.Message != "partial" {
+		t.Errorf("want the incomplete line at final EOF, but got %v", e)
+	}
+}
+
+func TestCompressedAfterScan(t *testing.T) {
+	dir := logs(t)
+	f, err := newFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	v := &viewer{filter: f, out: bufio.NewWriter(&buf), paths: []string{dir}}
+	if err = v.scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	// file.File compresses and removes app, and the retention removes db.
+	name := filepath.Join(dir, "app-20140218173000.000.txt")
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(b)
+	w.Close()
+	if err = os.WriteFile(name+".gz", gz.Bytes(), 0664); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(name)
+	os.Remove(filepath.Join(dir, "db-20140218173000.000.txt"))
+
+	if err = v.scan(); err != nil {
+		t.Fatal(err)
+	}
+	v.merge()
+	v.out.Flush()
+	if got, want := messages(buf.String()), "start,dial,slow,partial"; got != want {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+}
+
+// record returns the line of the i-th record, its message is m<i>.
+func record(i int) string {
+	return fmt.Sprintf(`app [I] 2014-02-18 17:30:%02d <app/main.go:10> "m%d"`+"\n", i, i)
+}
+
+func TestNaming(t *testing.T) {
+	for _, c := range []struct {
+		naming string
+		sets   file.Sets
+	}{
+		{"timestamp", file.Sets{Name: "app.log", Layout: "20060102"}},
+		{"timestamp", file.Sets{Name: "app.log"}},
+		{"numbered", file.Sets{Name: "app.log", Naming: file.NAME_NUMBERED, Compress: "gzip"}},
+		{"dated", file.Sets{Name: "app.log", Naming: file.NAME_DATED, Layout: "2006-01-02"}},
+	} {
+		dir := t.TempDir()
+		c.sets.Name = filepath.Join(dir, c.sets.Name)
+		f, err := file.NewSets(c.sets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// more than 10 rotations in the same second, the sequence and N are sorted by number
+		var want []string
+		now := time.Now()
+		for i := 0; i < 12; i++ {
+			f.Write([]byte(record(i)))
+			want = append(want, fmt.Sprint("m", i))
+			if i != 11 {
+				f.Rotate(now, now)
+			}
+		}
+		f.Close()
+		flags := map[string]string{"o": "raw", "naming": c.naming}
+		if len(c.sets.Layout) != 0 {
+			flags["layout"] = c.sets.Layout
+		}
+		if got := messages(view(t, flags, dir)); got != strings.Join(want, ",") {
+			t.Errorf("%s %s: want %s, but got %s", c.naming, c.sets.Layout, strings.Join(want, ","), got)
+		}
+	}
+}
+
+func TestFollowRotated(t *testing.T) {
+	flag.Set("f", "true")
+	defer flag.Set("f", "false")
+	flag.Set("naming", "numbered")
+	defer flag.Set("naming", "timestamp")
+
+	dir := t.TempDir()
+	f, err := file.NewSets(file.Sets{Name: filepath.Join(dir, "app.log"), Naming: file.NAME_NUMBERED})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	filter, err := newFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	v := &viewer{filter: filter, out: bufio.NewWriter(&buf), paths: []string{dir}}
+	f.Write([]byte(record(0)))
+	if err = v.scan(); err != nil {
+		t.Fatal(err)
+	}
+	v.merge()
+
+	// the current file is renamed to app.log.1, the lines are not read again
+	for i := 1; i < 5; i += 2 {
+		f.Write([]byte(record(i)))
+		f.Rotate(time.Now(), time.Now())
+		f.Write([]byte(record(i + 1)))
+		if err = v.scan(); err != nil {
+			t.Fatal(err)
+		}
+		v.tail()
+	}
+	v.out.Flush()
+	if got, want := messages(buf.String()), "m0,m1,m2,m3,m4"; got != want {
+		t.Errorf("want %s, but got %s", want, got)
+	}
+}
@@ -0,0 +1,206 @@
+package log
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+// +dl zh-cn
+/*
+  ContextLogger 是携带 context.Context 的级别日志接口.
+  通过 AddContextExtractor 注册的函数从 ctx 中提取字段, 附加到日志记录.
+*/
+// +dl
+
+// ContextLogger is the level logger interface with context.Context.
+type ContextLogger interface {
+	FatalContext(ctx context.Context, v ...interface{})
+	PanicContext(ctx context.Context, v ...interface{})
+	AlertContext(ctx context.Context, v ...interface{})
+	ErrorContext(ctx context.Context, v ...interface{})
+	ReportContext(ctx context.Context, v ...interface{})
+	NotifyContext(ctx context.Context, v ...interface{})
+	InfoContext(ctx context.Context, v ...interface{})
+	DebugContext(ctx context.Context, v ...interface{})
+}
+
+// +dl zh-cn
+// ContextExtractor 从 ctx 中提取字段, 比如 request ID, trace ID.
+// +dl
+
+// ContextExtractor returns the fields in ctx.
+type ContextExtractor func(ctx context.Context) Fields
+
+var extractors struct {
+	mu  sync.RWMutex
+	fns []*ContextExtractor // pointers identify the registrations
+}
+
+// +dl zh-cn
+// AddContextExtractor 注册 ContextExtractor, 所有 Context 方法都按注册顺序调用它们.
+// 返回的 remove 函数取消注册, 可以多次调用.
+// +dl
+
+// AddContextExtractor registers fn for all Context methods, remove unregisters it.
+func AddContextExtractor(fn ContextExtractor) (remove func()) {
+	if fn == nil {
+		return func() {}
+	}
+	p := &fn
+	extractors.mu.Lock()
+	extractors.fns = append(extractors.fns, p)
+	extractors.mu.Unlock()
+	return func() {
+		extractors.mu.Lock()
+		defer extractors.mu.Unlock()
+		for i, q := range extractors.fns {
+			if q == p {
+				extractors.fns = append(extractors.fns[:i:i], extractors.fns[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func contextFields(ctx context.Context) (fields Fields) {
+	extractors.mu.RLock()
+	defer extractors.mu.RUnlock()
+	for _, fn := range extractors.fns {
+		fields = append(fields, (*fn)(ctx)...)
+	}
+	return
+}
+
+type contextKey struct{}
+
+// +dl zh-cn
+// NewContext 返回保存了 Logger l 的 ctx 副本, 可用于中间件为每个请求附加派生的 Logger.
+// +dl
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// +dl zh-cn
+// FromContext 返回 NewContext 保存的 Logger, 没有时返回 nil.
+// +dl
+
+// FromContext returns the Logger stored by NewContext, or nil.
+func FromContext(ctx context.Context) Logger {
+	l, _ := ctx.Value(contextKey{}).(Logger)
+	return l
+}
+
+func (l *logger) DebugContext(ctx context.Context, v ...interface{}) {
+	if l.enabled(1, LDebug) {
+		l.output(2, printf("", v), LDebug, ctx)
+	}
+}
+
+func (l *logger) InfoContext(ctx context.Context, v ...interface{}) {
+	if l.enabled(1, LInfo) {
+		l.output(2, printf("", v), LInfo, ctx)
+	}
+}
+
+func (l *logger) NotifyContext(ctx context.Context, v ...interface{}) {
+	if l.enabled(1, LNotify) {
+		l.output(2, printf("", v), LNotify, ctx)
+	}
+}
+
+func (l *logger) ReportContext(ctx context.Context, v ...interface{}) {
+	if l.enabled(1, LReport) {
+		l.output(2, printf("", v), LReport, ctx)
+	}
+}
+
+func (l *logger) ErrorContext(ctx context.Context, v ...interface{}) {
+	if l.enabled(1, LError) {
+		l.output(2, printf("", v), LError, ctx)
+	}
+}
+
+func (l *logger) AlertContext(ctx context.Context, v ...interface{}) {
+	if l.enabled(1, LAlert) {
+		l.output(2, printf("", v), LAlert, ctx)
+	}
+}
+
+func (l *logger) PanicContext(ctx context.Context, v ...interface{}) {
+	l.output(2, printf("", v), LPanic, ctx)
+	if 0 == _dont_panic&l.getModes() {
+		panic(v)
+	}
+}
+
+func (l *logger) FatalContext(ctx context.Context, v ...interface{}) {
+	l.output(2, printf("", v), LFatal, ctx)
+	if 0 == _dont_exit&l.getModes() {
+		os.Exit(1)
+	}
+}
+
+// outputContext writes v with ctx to the loggers which enable level,
+// v is formatted and the fields of ctx are extracted only once when they are needed.
+func (self *multi) outputContext(ctx context.Context, level int, v []interface{}) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	var s string
+	var fields Fields
+	formatted, extracted := false, false
+	for _, l := range self.loggers {
+		if l == nil {
+			continue
+		}
+		ll, ok := l.(*logger)
+		if ok && !ll.enabled(2, level) || !ok && !l.Enabled(level) {
+			continue
+		}
+		if !formatted {
+			s, formatted = printf("", v), true
+		}
+		if ok {
+			ll.output(3, s, level, ctx)
+			continue
+		}
+		if !extracted {
+			fields, extracted = contextFields(ctx), true
+		}
+		l.WithFields(fields).Output(3, s, level)
+	}
+}
+
+func (self *multi) DebugContext(ctx context.Context, v ...interface{}) {
+	self.outputContext(ctx, LDebug, v)
+}
+
+func (self *multi) InfoContext(ctx context.Context, v ...interface{}) {
+	self.outputContext(ctx, LInfo, v)
+}
+
+func (self *multi) NotifyContext(ctx context.Context, v ...interface{}) {
+	self.outputContext(ctx, LNotify, v)
+}
+
+func (self *multi) ReportContext(ctx context.Context, v ...interface{}) {
+	self.outputContext(ctx, LReport, v)
+}
+
+func (self *multi) ErrorContext(ctx context.Context, v ...interface{}) {
+	self.outputContext(ctx, LError, v)
+}
+
+func (self *multi) AlertContext(ctx context.Context, v ...interface{}) {
+	self.outputContext(ctx, LAlert, v)
+}
+
+func (self *multi) FatalContext(ctx context.Context, v ...interface{}) {
+	self.outputContext(ctx, LFatal, v)
+}
+
+func (self *multi) PanicContext(ctx context.Context, v ...interface{}) {
+	self.outputContext(ctx, LPanic, v)
+}
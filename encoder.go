@@ -0,0 +1,230 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// +dl zh-cn
+/*
+  Record 是一条完整的日志记录, Output 把它交给 Encoder 编码.
+  Message 为原始消息, 未经 strconv.Quote.
+  File, Line 只在 Flags 包含 Lshortfile 或 Llongfile 时有效.
+*/
+// +dl
+
+// Record is a logging event passed to Encoder.
+type Record struct {
+	Time    time.Time
+	Level   int
+	Prefix  string
+	Flags   int
+	File    string
+	Line    int
+	Message string
+	Fields  Fields
+	PC      uintptr // program counter of caller, 0 if unknown
+	modes   int
+	ctx     context.Context
+}
+
+// +dl zh-cn
+// HasMode 返回建立 Record 的 Logger 是否设置了 mode, mode 为 MODE_* 常量.
+// +dl
+
+// HasMode reports whether the logger of Record has the MODE_* mode.
+func (r *Record) HasMode(mode int) bool {
+	bit := modeBit(mode)
+	return bit != 0 && 0 != r.modes&bit
+}
+
+// +dl zh-cn
+// Caller 按 Flags 返回 "file:line", 未设置 Lshortfile 或 Llongfile 时返回 "".
+// +dl
+
+// Caller returns "file:line" by Flags, returns "" if no caller flags.
+func (r *Record) Caller() string {
+	if r.Flags&(Lshortfile|Llongfile) == 0 {
+		return ""
+	}
+	buf := make([]byte, 0, len(r.File)+8)
+	buf = r.appendCaller(buf)
+	return string(buf)
+}
+
+func (r *Record) appendCaller(buf []byte) []byte {
+	file := r.File
+	if r.Flags&Lshortfile != 0 {
+		for i := len(file) - 1; i > 0; i-- {
+			if file[i] == '/' {
+				file = file[i+1:]
+				break
+			}
+		}
+	}
+	buf = append(buf, file...)
+	buf = append(buf, ':')
+	itoa(&buf, r.Line, -1)
+	return buf
+}
+
+// +dl zh-cn
+/*
+  Encoder 把 Record 编码后追加到 buf, 返回追加后的 buf.
+  Encode 在 Logger 的锁内被调用, 不可以保留 r.
+*/
+// +dl
+
+// Encoder appends the encoded Record to buf and returns the extended buffer.
+// Encode must not retain r.
+type Encoder interface {
+	Encode(buf []byte, r *Record) []byte
+}
+
+// +dl zh-cn
+/*
+  RecordWriter 是可以直接接收 Record 的 io.Writer.
+  如果 New 的 writer 实现了 RecordWriter, Output 不再编码, 直接调用 WriteRecord,
+  Record 的字段作为独立的结构化属性被传递, 并且总是包含调用者信息.
+  WriteRecord 在 Logger 的锁内被调用, 不可以保留 r.
+*/
+// +dl
+
+// RecordWriter is an io.Writer accepts Record without encoding.
+// WriteRecord must not retain r.
+type RecordWriter interface {
+	io.Writer
+	WriteRecord(r *Record) error
+}
+
+// +dl zh-cn
+/*
+  TextEncoder 是缺省的 Encoder, 格式为:
+
+	prefix [I] 2014-02-18 17:30:27.154305 <hello.go:25> "message" key=value
+*/
+// +dl
+
+// TextEncoder is the default Encoder.
+var TextEncoder Encoder = textEncoder{}
+
+type textEncoder struct{}
+
+func (textEncoder) Encode(buf []byte, r *Record) []byte {
+	formatHeader(&buf, r)
+	if len(r.Message) != 0 {
+		buf = strconv.AppendQuote(buf, r.Message)
+		formatFields(&buf, r.Fields)
+	} else if len(r.Fields) != 0 {
+		n := len(buf)
+		formatFields(&buf, r.Fields)
+		buf = append(buf[:n], buf[n+1:]...) // no separator without the message
+	}
+	if len(r.Message) != 0 || len(r.Fields) != 0 {
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+func formatHeader(buf *[]byte, r *Record) {
+	if len(r.Prefix) != 0 {
+		*buf = append(*buf, r.Prefix...)
+		*buf = append(*buf, ' ')
+	}
+
+	level := r.Level
+	if level > nr_levels && level <= 0 && 0 == _none_name&r.modes {
+		*buf = append(*buf, levelsName[-level]...)
+		*buf = append(*buf, ' ')
+	}
+
+	t := r.Time
+	if r.Flags&(Ldate|Ltime|Lmicroseconds) != 0 {
+		if r.Flags&Ldate != 0 {
+			year, month, day := t.Date()
+			itoa(buf, year, 4)
+			*buf = append(*buf, '-')
+			itoa(buf, int(month), 2)
+			*buf = append(*buf, '-')
+			itoa(buf, day, 2)
+			*buf = append(*buf, ' ')
+		}
+		if r.Flags&(Ltime|Lmicroseconds) != 0 {
+			hour, min, sec := t.Clock()
+			itoa(buf, hour, 2)
+			*buf = append(*buf, ':')
+			itoa(buf, min, 2)
+			*buf = append(*buf, ':')
+			itoa(buf, sec, 2)
+			if r.Flags&Lmicroseconds != 0 {
+				*buf = append(*buf, '.')
+				itoa(buf, t.Nanosecond()/1e3, 6)
+			}
+			*buf = append(*buf, ' ')
+		}
+	}
+	if r.Flags&(Lshortfile|Llongfile) != 0 {
+		*buf = append(*buf, '<')
+		*buf = r.appendCaller(*buf)
+		*buf = append(*buf, `> `...)
+	}
+}
+
+// appendValue appends the text form of a field value, strings are quoted.
+func appendValue(buf *[]byte, v interface{}) {
+	switch x := v.(type) {
+	case nil:
+		*buf = append(*buf, "nil"...)
+	case string:
+		*buf = strconv.AppendQuote(*buf, x)
+	case bool:
+		*buf = strconv.AppendBool(*buf, x)
+	case int:
+		*buf = strconv.AppendInt(*buf, int64(x), 10)
+	case int8:
+		*buf = strconv.AppendInt(*buf, int64(x), 10)
+	case int16:
+		*buf = strconv.AppendInt(*buf, int64(x), 10)
+	case int32:
+		*buf = strconv.AppendInt(*buf, int64(x), 10)
+	case int64:
+		*buf = strconv.AppendInt(*buf, x, 10)
+	case uint:
+		*buf = strconv.AppendUint(*buf, uint64(x), 10)
+	case uint8:
+		*buf = strconv.AppendUint(*buf, uint64(x), 10)
+	case uint16:
+		*buf = strconv.AppendUint(*buf, uint64(x), 10)
+	case uint32:
+		*buf = strconv.AppendUint(*buf, uint64(x), 10)
+	case uint64:
+		*buf = strconv.AppendUint(*buf, x, 10)
+	case float32:
+		*buf = strconv.AppendFloat(*buf, float64(x), 'g', -1, 32)
+	case float64:
+		*buf = strconv.AppendFloat(*buf, x, 'g', -1, 64)
+	case time.Duration:
+		*buf = strconv.AppendQuote(*buf, x.String())
+	case time.Time:
+		*buf = strconv.AppendQuote(*buf, x.Format(time.RFC3339Nano))
+	case error:
+		*buf = strconv.AppendQuote(*buf, x.Error())
+	case fmt.Stringer:
+		*buf = strconv.AppendQuote(*buf, x.String())
+	default:
+		*buf = strconv.AppendQuote(*buf, fmt.Sprint(x))
+	}
+}
+
+// formatFields appends fields as " key=value" pairs.
+func formatFields(buf *[]byte, fields Fields) {
+	for _, f := range fields {
+		*buf = append(*buf, ' ')
+		*buf = append(*buf, f.Key...)
+		*buf = append(*buf, '=')
+		appendValue(buf, f.Value)
+	}
+}
@@ -0,0 +1,74 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+type levelEncoder struct{}
+
+func (levelEncoder) Encode(buf []byte, r *Record) []byte {
+	buf = append(buf, levelsName[-r.Level]...)
+	buf = append(buf, r.Prefix...)
+	buf = append(buf, r.Message...)
+	if r.HasMode(MODE_DONT_EXIT) {
+		buf = append(buf, '!')
+	}
+	return append(buf, '\n')
+}
+
+func TestEncoder(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	l := NewWithEncoder(w, "prefix", levelEncoder{}, 0, MODE_DONT_EXIT)
+	l.Error(`"error"`)
+	check(t, w, `[E]prefix"error"!`)
+
+	r := Record{File: "/a/b/c.go", Line: 12, Flags: Lshortfile}
+	if got := r.Caller(); got != "c.go:12" {
+		t.Errorf("want: c.go:12, but got: %#v", got)
+	}
+	r.Flags = Llongfile
+	if got := r.Caller(); got != "/a/b/c.go:12" {
+		t.Errorf("want: /a/b/c.go:12, but got: %#v", got)
+	}
+}
+
+func TestJSONEncoder(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	l := New(w, "prefix", 0, MODE_JSON)
+	l.With("n", 1, "s", "a\"b\n\u2028", "nan", math.NaN(), "m", map[string]int{"x": 1}).
+		Error("中文\x00\xff")
+	check(t, w, `{"level":"error","prefix":"prefix","msg":"中文\u0000\ufffd","n":1,"s":"a\"b\n\u2028","nan":"NaN","m":{"x":1}}`)
+
+	l = New(w, "", LstdFlags|Lmicroseconds|Lshortfile, MODE_JSON)
+	l.Info("info")
+	var m map[string]interface{}
+	if err := json.Unmarshal(w.Bytes(), &m); err != nil {
+		t.Fatal(err, w.String())
+	}
+	w.Reset()
+	if m["caller"] != "encoder_test.go:47" || m["msg"] != "info" || m["level"] != "info" {
+		t.Errorf("unexpected: %#v", m)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, m["time"].(string)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	l := New(w, "db", Lshortfile, MODE_LOGFMT)
+	l.With("n", 1, "s", "a b", "e", "", "g", Fields{{"x", 1}, {"y", "z"}}, "m", []int{1, 2}).
+		Error("failed")
+	check(t, w, `level=error prefix=db caller=encoder_test.go:65 msg=failed n=1 s="a b" e="" g.x=1 g.y=z m=[1,2]`)
+}
+
+func TestNewIntFlags(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	flags := []int{0, MODE_NONE_NAME}
+	New(w, "", flags...).Info("int flags")
+	check(t, w, `"int flags"`)
+}
@@ -0,0 +1,82 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWith(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	l := New(w, "prefix", 0)
+
+	d := l.With("id", 42, "name", "bob")
+	d.Info("info")
+	check(t, w, `prefix [I] "info" id=42 name="bob"`)
+
+	// the parent logger is not affected
+	l.Info("info")
+	check(t, w, `prefix [I] "info"`)
+
+	d = d.WithFields(Fields{{"ok", true}, {"d", time.Second}})
+	d.Errorf("%d", 1)
+	check(t, w, `prefix [E] "1" id=42 name="bob" ok=true d="1s"`)
+
+	l.With(Field{"err", errors.New("EOF")}, "odd").Info("")
+	check(t, w, `prefix [I] err="EOF" !BADKEY="odd"`)
+
+	m := Multi(l, New(w, "", 0, MODE_NONE_NAME))
+	m.With("k", 1.5).Notify("multi")
+	check(t, w, `prefix [N] "multi" k=1.5`+"\n"+`"multi" k=1.5`)
+}
+
+type requestID struct{}
+
+func TestContext(t *testing.T) {
+	remove := AddContextExtractor(func(ctx context.Context) Fields {
+		if id, ok := ctx.Value(requestID{}).(string); ok {
+			return Fields{{"request", id}}
+		}
+		return nil
+	})
+	t.Cleanup(remove)
+
+	w := bytes.NewBuffer(nil)
+	ctx := context.WithValue(context.Background(), requestID{}, "r1")
+	ctx = NewContext(ctx, New(w, "", Lshortfile).With("user", 1))
+
+	l := FromContext(ctx)
+	l.InfoContext(ctx, "info")
+	check(t, w, `[I] <fields_test.go:51> "info" user=1 request="r1"`)
+
+	l.Info("info")
+	check(t, w, `[I] <fields_test.go:54> "info" user=1`)
+
+	Multi(l).ErrorContext(ctx, "multi")
+	check(t, w, `[E] <fields_test.go:57> "multi" user=1 request="r1"`)
+
+	if FromContext(context.Background()) != nil {
+		t.Error("want nil Logger")
+	}
+
+	remove()
+	remove()
+	l.InfoContext(ctx, "removed")
+	check(t, w, `[I] <fields_test.go:66> "removed" user=1`)
+	// the disabled records are not formatted and the fields are not extracted
+	calls := 0
+	t.Cleanup(AddContextExtractor(func(ctx context.Context) Fields {
+		calls++
+		return Fields{{"calls", calls}}
+	}))
+	quiet := New(w, "", 0, LError)
+	quiet.DebugContext(ctx, "debug")
+	Multi(quiet).DebugContext(ctx, "debug")
+	if calls != 0 {
+		t.Errorf("want no extraction, but got %d", calls)
+	}
+	Multi(quiet, New(w, "", Lshortfile)).InfoContext(ctx, "multi")
+	check(t, w, `[I] <fields_test.go:80> "multi" calls=1`)
+}
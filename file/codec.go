@@ -0,0 +1,149 @@
+package file
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Codec compresses the rotated files.
+type Codec interface {
+	// Name returns the name used by Sets.Compress, e.g. "gzip".
+	Name() string
+	// Ext returns the extension appended to the compressed file, e.g. ".gz".
+	Ext() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var codecs struct {
+	mu sync.RWMutex
+	m  map[string]Codec
+}
+
+func init() {
+	RegisterCodec(gzipCodec{})
+}
+
+// RegisterCodec registers c by its name, replaces the old one of the same name.
+// The gzip codec is registered by default, e.g. zstd can be registered by the user.
+func RegisterCodec(c Codec) {
+	codecs.mu.Lock()
+	if codecs.m == nil {
+		codecs.m = map[string]Codec{}
+	}
+	codecs.m[c.Name()] = c
+	codecs.mu.Unlock()
+}
+
+// LookupCodec returns the registered Codec of name, or nil.
+func LookupCodec(name string) Codec {
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+	return codecs.m[name]
+}
+
+// CodecOf returns the registered Codec by the extension of name, or nil if name is not compressed.
+func CodecOf(name string) Codec {
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+	for _, c := range codecs.m {
+		if strings.HasSuffix(name, c.Ext()) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Open opens the file of name for reading, the compressed file is decompressed transparently.
+func Open(name string) (io.ReadCloser, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	c := CodecOf(name)
+	if c == nil {
+		return fd, nil
+	}
+	r, err := c.NewReader(fd)
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return &reader{r, fd}, nil
+}
+
+type reader struct {
+	io.ReadCloser
+	fd *os.File
+}
+
+func (r *reader) Close() error {
+	err := r.ReadCloser.Close()
+	if e := r.fd.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+func (gzipCodec) Ext() string  { return ".gz" }
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// compress compresses the file of name by c, the compressed file is written to
+// a temporary name and renamed when it is complete, then the file of name is removed.
+func compress(name string, c Codec, perm os.FileMode) (err error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	tmp := name + c.Ext() + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	w, err := c.NewWriter(out)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(w, in); err != nil {
+		w.Close()
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+	if err = out.Sync(); err != nil {
+		return
+	}
+	if err = out.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, name+c.Ext()); err != nil {
+		return
+	}
+	return os.Remove(name)
+}
+
+var errCodec = errors.New("file: unknown codec")
@@ -1,14 +1,83 @@
 package file
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/typepress/log"
 )
 
+// Sets for NewSets.
+//
+// The retention of the rotated files, the value 0 means no limit:
+//
+//	MaxFiles the number of files to keep, including the current file
+//	MaxAge   the files older than MaxAge minutes are deleted
+//	MaxBytes the total bytes of the files in the directory
+//
+// Only the files named by the prefix and ext of File are deleted, unless All is true,
+// then all the regular files in the directory are considered.
+// The cleanup runs in the background after each rotation.
+//
+// If Compress is the name of a registered Codec, e.g. "gzip",
+// the rotated file is compressed in the background.
+//
+// Naming is the scheme of the file names, one of NAME_*.
+// Layout is the time layout in the names, the default is "20060102150405.000".
+// Link is the name of a symbolic link in the directory, e.g. "current",
+// which points to the current file, it is maintained only by NAME_TIMESTAMP.
+// The rotated file of NAME_NUMBERED is shifted to name.ext.1 in the background,
+// it is name.ext.0.N meanwhile.
+//
+// If Check > 0, Write checks at most every Check milliseconds whether the file
+// is moved or deleted, e.g. by logrotate, and reopens the name of the file.
+//
+// Perm and DirPerm are the permission of the created files and directory,
+// the default is 0664 and os.ModePerm, both are masked by umask.
+//
+// OnError is called with the errors of open, rotation, write and compression,
+// it may be called by the background goroutine, and must not call the methods of File.
+// If Fallback is not nil, e.g. os.Stderr, the writes go to Fallback while the file
+// can't be written. The failed file is reopened by the next Write.
+type Sets struct {
+	Name string
+
+	Naming int
+	Layout string
+	Link   string
+
+	MaxFiles, MaxAge int
+	MaxBytes         int64
+	All              bool
+
+	Compress string
+
+	Check int
+
+	Perm, DirPerm os.FileMode
+
+	OnError  func(error)
+	Fallback io.Writer
+}
+
+// New returns File of name, it is NewSets(Sets{Name: name}).
 func New(name string) (*File, error) {
-	name = filepath.ToSlash(name)
+	return NewSets(Sets{Name: name})
+}
+
+// NewSets returns File of sets.Name, the rotated files are cleaned up by sets.
+func NewSets(sets Sets) (*File, error) {
+	var codec Codec
+	if len(sets.Compress) != 0 {
+		if codec = LookupCodec(sets.Compress); codec == nil {
+			return nil, errCodec
+		}
+	}
+	name := filepath.ToSlash(sets.Name)
 	isDir := strings.HasSuffix(name, "/")
 	name, err := filepath.Abs(name)
 
@@ -25,10 +94,14 @@ func New(name string) (*File, error) {
 	}
 
 	dir, name := filepath.Split(name)
-	fi, _ := os.Stat(name)
-
-	if fi == nil {
-		os.MkdirAll(dir, os.ModePerm)
+	if sets.Perm == 0 {
+		sets.Perm = 0664
+	}
+	if sets.DirPerm == 0 {
+		sets.DirPerm = os.ModePerm
+	}
+	if err = os.MkdirAll(dir, sets.DirPerm); err != nil {
+		return nil, err
 	}
 
 	ext := filepath.Ext(name)
@@ -37,46 +110,193 @@ func New(name string) (*File, error) {
 	} else {
 		name = name[:len(name)-len(ext)]
 	}
-	prefix := strings.SplitN(name, `-`, 2)[0]
+	prefix := name
+	if sets.Naming == NAME_TIMESTAMP {
+		prefix = strings.SplitN(name, `-`, 2)[0]
+	} else {
+		name = filepath.Join(dir, prefix+ext)
+	}
+	if len(sets.Layout) == 0 {
+		sets.Layout = DefaultLayout
+	}
 
-	f := &File{nil, dir, prefix, ext, name}
+	f := &File{fd: nil, dir: dir, prefix: prefix, ext: ext, Name: name, sets: sets, codec: codec}
 	t := time.Now()
-	f.Rotate(t, t)
-	return f, err
+	if err = f.Rotate(t, t); err != nil {
+		return nil, err
+	}
+	register(f)
+	return f, nil
 }
 
-var layout = "20060102150405.000"
+// DefaultLayout is the default time layout of Sets.Layout.
+const DefaultLayout = "20060102150405.000"
+
+// File is a log.RotateErrWriter, it is rotated by log.RotateErr.
+var _ log.RotateErrWriter = (*File)(nil)
 
 type File struct {
 	fd                     *os.File
 	dir, prefix, ext, Name string
+	sets                   Sets
+	codec                  Codec
+	cmu                    sync.Mutex // serializes compression and cleanup
+	bg                     sync.WaitGroup
+	mu                     sync.Mutex    // guards fd, checked, closed and last
+	last                   chan struct{} // closed when the last background job is done
+	checked                time.Time
+	closed                 bool
 }
 
-func (f *File) Rotate(begin, now time.Time) {
-	f.Close()
-	for {
-		name := filepath.Join(
-			f.dir, f.prefix+`-`+now.Format(layout)+f.ext,
-		)
-		fi, _ := os.Stat(name)
-		if fi == nil && name != f.Name {
-			f.Name = name
-			break
+// Rotate closes the current file and opens the new one by Sets.Naming.
+// The error is reported to Sets.OnError too.
+func (f *File) Rotate(begin, now time.Time) (err error) {
+	f.mu.Lock()
+	defer func() {
+		f.report(err)
+		f.mu.Unlock()
+	}()
+	if f.closed {
+		return log.ErrClosed
+	}
+	old := ""
+	if f.fd != nil {
+		old = f.Name
+	}
+	err = f.close()
+	var e error
+	switch f.sets.Naming {
+	case NAME_NUMBERED:
+		if len(old) != 0 { // shifted by the background job
+			name := f.pending()
+			if e = os.Rename(old, name); e == nil {
+				old = name
+			} else {
+				old = ""
+			}
 		}
-		now.Add(time.Duration(1e6))
+	case NAME_DATED:
+		if len(old) != 0 {
+			name := f.next(now)
+			if e = os.Rename(old, name); e == nil {
+				old = name
+			} else {
+				old = ""
+			}
+		}
+	default:
+		f.Name = f.next(now)
+	}
+	if err == nil {
+		err = e
 	}
-	f.fd, _ = os.OpenFile(f.Name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0664)
+	if e = f.open(); err == nil {
+		err = e
+	}
+	if len(f.sets.Link) != 0 && f.sets.Naming == NAME_TIMESTAMP && f.fd != nil {
+		if e = f.link(); err == nil {
+			err = e
+		}
+	}
+	if f.codec != nil && len(old) != 0 || f.sets.Naming == NAME_NUMBERED && len(old) != 0 ||
+		f.sets.MaxFiles > 0 || f.sets.MaxAge > 0 || f.sets.MaxBytes > 0 {
+		prev, done := f.last, make(chan struct{})
+		f.last = done
+		f.bg.Add(1)
+		go f.background(old, prev, done)
+	}
+	return
+}
+
+// background shifts and compresses the rotated file old, then cleans up the files
+// except the current one. It starts after the previous job prev is done, and closes done.
+func (f *File) background(old string, prev, done chan struct{}) {
+	if prev != nil {
+		<-prev
+	}
+	f.cmu.Lock()
+	defer func() {
+		f.cmu.Unlock()
+		close(done)
+		f.bg.Done()
+	}()
+	if f.sets.Naming == NAME_NUMBERED && len(old) != 0 {
+		var err error
+		if old, err = f.shift(old); err != nil {
+			f.report(err)
+		}
+	}
+	if f.codec != nil && len(old) != 0 {
+		if err := compress(old, f.codec, f.sets.Perm); err != nil {
+			f.report(err)
+		}
+	}
+	f.mu.Lock() // the file may be rotated again meanwhile
+	current, since := f.Name, time.Now()
+	f.mu.Unlock()
+	f.cleanup(current, since)
+}
+
+// open opens f.Name, f.fd is nil if it fails.
+func (f *File) open() (err error) {
+	f.fd, err = os.OpenFile(f.Name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, f.sets.Perm)
+	if err != nil {
+		f.fd = nil
+	}
+	f.checked = time.Now()
 	return
 }
 
+// report calls Sets.OnError if err is not nil.
+func (f *File) report(err error) {
+	if err != nil && f.sets.OnError != nil {
+		f.sets.OnError(err)
+	}
+}
+
+// Write writes b to the file, the file is reopened if the last open or write failed.
+// If it fails again, the error is reported and b is written to Sets.Fallback.
 func (f *File) Write(b []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, log.ErrClosed
+	}
+	if f.fd != nil && f.sets.Check > 0 &&
+		time.Since(f.checked) >= time.Duration(f.sets.Check)*time.Millisecond {
+		f.check()
+	}
 	if f.fd == nil {
-		return 0, os.ErrNotExist
+		err = f.open()
 	}
-	return f.fd.Write(b)
+	if f.fd != nil {
+		if n, err = f.fd.Write(b); err == nil {
+			return
+		}
+		f.close()
+	}
+	f.report(err)
+	if f.sets.Fallback != nil {
+		m, e := f.sets.Fallback.Write(b[n:])
+		return n + m, e
+	}
+	return
 }
 
+// Close closes the file, and removes it from the Files reopened by ReopenAll.
+// It waits for the background compression and cleanup.
+// Write returns log.ErrClosed after Close.
 func (f *File) Close() (err error) {
+	unregister(f)
+	f.mu.Lock()
+	f.closed = true
+	err = f.close()
+	f.mu.Unlock()
+	f.bg.Wait()
+	return
+}
+
+func (f *File) close() (err error) {
 	if f.fd == nil {
 		return nil
 	}
@@ -1,8 +1,15 @@
 package file
 
 import (
+	"bytes"
 	"github.com/achun/testing-want"
+	"github.com/typepress/log"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -39,3 +46,362 @@ func Testfile(t *testing.T, path string) {
 	wt.True(f.Name != name, "rotate failed: ", name)
 	wt.Nil(os.Remove(name))
 }
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	names := []string{
+		"app-20140101000000.000.txt", // oldest
+		"app-20140102000000.000.txt",
+		"app-20140103000000.000.txt",
+		"app-20140104000000.000.txt",
+		"other.txt",
+	}
+	for i, name := range names {
+		name = filepath.Join(dir, name)
+		if err := os.WriteFile(name, make([]byte, 100), 0664); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(time.Duration(i-len(names)) * time.Hour)
+		os.Chtimes(name, mtime, mtime)
+	}
+	exists := func(want ...string) {
+		t.Helper()
+		entries, _ := os.ReadDir(dir)
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+		sort.Strings(want)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("want %v, but got %v", want, got)
+		}
+	}
+
+	f, err := NewSets(Sets{Name: filepath.Join(dir, "app.txt"), MaxFiles: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	current := filepath.Base(f.Name)
+	f.bg.Wait()
+	f.cmu.Lock()
+	f.cleanup(f.Name, time.Now())
+	f.cmu.Unlock()
+	exists(append(names[1:], current)...)
+
+	f.cmu.Lock()
+	f.sets = Sets{MaxAge: 150}
+	f.cleanup(f.Name, time.Now())
+	f.cmu.Unlock()
+	exists(names[3], names[4], current)
+
+	f.cmu.Lock()
+	f.sets = Sets{MaxBytes: 150, All: true}
+	f.cleanup(f.Name, time.Now())
+	f.cmu.Unlock()
+	exists(names[4], current)
+
+	// the file created after since, e.g. by the next rotation, is kept
+	os.WriteFile(filepath.Join(dir, "app-new.txt"), nil, 0664)
+	f.cmu.Lock()
+	f.sets = Sets{MaxFiles: 1, All: true}
+	f.cleanup(f.Name, now.Add(-time.Minute))
+	f.cmu.Unlock()
+	exists("app-new.txt", current)
+}
+
+func TestCompress(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewSets(Sets{Name: dir, Compress: "zip"}); err == nil {
+		t.Fatal("want error of unknown codec")
+	}
+	f, err := NewSets(Sets{Name: dir, Compress: "gzip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write([]byte("line\n"))
+	old := f.Name
+	f.Rotate(time.Now(), time.Now().Add(time.Second))
+	f.bg.Wait()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("the rotated file is not removed: %v", err)
+	}
+	r, err := Open(old + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil || string(b) != "line\n" {
+		t.Errorf("want %q, but got %q %v", "line\n", b, err)
+	}
+	if CodecOf(old) != nil || CodecOf(old+".gz") == nil || !f.own(filepath.Base(old)+".gz") {
+		t.Error("CodecOf or own failed")
+	}
+}
+
+// blockCodec is gzip with the extension ".block", NewWriter waits for release.
+type blockCodec struct {
+	gzipCodec
+	release chan struct{}
+}
+
+func (blockCodec) Name() string { return "block" }
+func (blockCodec) Ext() string  { return ".block" }
+
+func (c blockCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	<-c.release
+	return c.gzipCodec.NewWriter(w)
+}
+
+func TestNumberedCompress(t *testing.T) {
+	c := blockCodec{release: make(chan struct{})}
+	RegisterCodec(c)
+	dir := t.TempDir()
+	f, err := NewSets(Sets{Name: filepath.Join(dir, "app.log"), Naming: NAME_NUMBERED, Compress: "block"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, s := range []string{"a", "b", "c"} {
+			f.Write([]byte(s))
+			f.Rotate(time.Now(), time.Now())
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Rotate waits for the background compression")
+	}
+	close(c.release)
+	f.Close()
+
+	got := ""
+	for _, name := range []string{"app.log.3.block", "app.log.2.block", "app.log.1.block"} {
+		r, err := Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(r)
+		r.Close()
+		got += string(b)
+	}
+	if entries, _ := os.ReadDir(dir); got != "abc" || len(entries) != 4 {
+		t.Errorf("want %q in 4 files, but got %q in %v", "abc", got, entries)
+	}
+}
+
+func TestNaming(t *testing.T) {
+	read := func(name string) string {
+		t.Helper()
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Error(err)
+		}
+		return string(b)
+	}
+
+	dir := t.TempDir()
+	f, err := NewSets(Sets{Name: filepath.Join(dir, "app.log"), Naming: NAME_NUMBERED})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := filepath.Join(dir, "app.log")
+	for _, s := range []string{"a", "b", "c"} {
+		if f.Name != current {
+			t.Fatalf("want %s, but got %s", current, f.Name)
+		}
+		f.Write([]byte(s))
+		f.Rotate(time.Now(), time.Now())
+	}
+	f.Close()
+	if got := read(current) + read(current+".1") + read(current+".2") + read(current+".3"); got != "cba" {
+		t.Errorf("want %q, but got %q", "cba", got)
+	}
+
+	dir = t.TempDir()
+	f, err = NewSets(Sets{Name: filepath.Join(dir, "app.log"), Naming: NAME_DATED, Layout: "2006-01-02"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("a"))
+	f.Rotate(time.Now(), time.Date(2014, 4, 16, 12, 0, 0, 0, time.Local))
+	f.Write([]byte("b"))
+	f.Close()
+	if got := read(filepath.Join(dir, "app.log.2014-04-16")) + read(f.Name); got != "ab" {
+		t.Errorf("want %q, but got %q", "ab", got)
+	}
+
+	dir = t.TempDir()
+	f, err = NewSets(Sets{Name: filepath.Join(dir, "app.log"), Link: "current", MaxFiles: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	now := time.Now()
+	for i := 1; i <= 2; i++ {
+		if target, err := os.Readlink(filepath.Join(dir, "current")); err != nil || target != filepath.Base(f.Name) {
+			t.Errorf("want link to %s, but got %s %v", filepath.Base(f.Name), target, err)
+		}
+		f.Rotate(now, now.Add(time.Duration(i)*time.Second))
+	}
+	f.bg.Wait()
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("want the current file and the link, but got %v", entries)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	f, err := NewSets(Sets{Name: name, Naming: NAME_NUMBERED, Check: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	content := func(want string) {
+		t.Helper()
+		if b, err := os.ReadFile(name); err != nil || string(b) != want {
+			t.Errorf("want %q, but got %q %v", want, b, err)
+		}
+	}
+
+	f.Write([]byte("a"))
+	os.Rename(name, name+".moved") // logrotate create
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("b"))
+	content("b")
+
+	os.Remove(name) // deleted, reopened by Check
+	time.Sleep(2 * time.Millisecond)
+	f.Write([]byte("c"))
+	content("c")
+
+	os.Rename(name, name+".moved")
+	if err := ReopenAll(); err != nil {
+		t.Fatal(err)
+	}
+	content("")
+
+	stop := HandleSignals()
+	defer stop()
+	p, _ := os.FindProcess(os.Getpid())
+	os.Remove(name)
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Skip(err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(name); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("the file is not reopened on SIGHUP")
+}
+
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+	regular := filepath.Join(dir, "regular")
+	os.WriteFile(regular, nil, 0664)
+	if _, err := New(filepath.Join(regular, "log.txt")); err == nil {
+		t.Error("want error of MkdirAll")
+	}
+
+	var errs []error
+	var fallback bytes.Buffer
+	sub := filepath.Join(dir, "sub")
+	f, err := NewSets(Sets{Name: sub + "/", Perm: 0600, DirPerm: 0700, Layout: "2006",
+		OnError: func(err error) { errs = append(errs, err) }, Fallback: &fallback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if fi, err := os.Stat(sub); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("want dir mode 0700, but got %v", fi)
+	}
+	if fi, err := os.Stat(f.Name); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("want file mode 0600, but got %v", fi)
+	}
+
+	// the coarse layout doesn't loop, the same now gets the sequence
+	now := time.Now()
+	first := f.Name
+	f.Rotate(now, now)
+	f.Rotate(now, now)
+	if want := strings.TrimSuffix(first, ".txt") + ".2.txt"; f.Name != want {
+		t.Errorf("want %s, but got %s", want, f.Name)
+	}
+
+	os.RemoveAll(sub)
+	if err := f.Rotate(now, now); err == nil || len(errs) != 1 {
+		t.Fatalf("want error of Rotate, but got %v %v", err, errs)
+	}
+	if n, err := f.Write([]byte("lost?")); n != 5 || err != nil || fallback.String() != "lost?" || len(errs) != 2 {
+		t.Errorf("want the fallback write, but got %d %v %q %v", n, err, fallback.String(), errs)
+	}
+
+	os.Mkdir(sub, 0700) // retried by the next write
+	f.Write([]byte("ok"))
+	if b, err := os.ReadFile(f.Name); err != nil || string(b) != "ok" || len(errs) != 2 {
+		t.Errorf("want the file reopened, but got %q %v %v", b, err, errs)
+	}
+	// File is a log.RotateErrWriter, the error of Rotate is returned by Write
+	os.RemoveAll(sub)
+	w := log.RotateErr(f, log.RotateSets{Size: 1})
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Error("want the error of Rotate")
+	}
+	os.Mkdir(sub, 0700)
+
+	f.Close()
+	if _, err := f.Write([]byte("x")); err != log.ErrClosed {
+		t.Errorf("want ErrClosed, but got %v", err)
+	}
+}
+
+func TestParseName(t *testing.T) {
+	at := func(s string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02 15:04:05.000", s, time.Local)
+		return t
+	}
+	for _, c := range []struct {
+		naming       int
+		layout, base string
+		want         Name
+		ok           bool
+	}{
+		{NAME_TIMESTAMP, "", "app-20140416120000.500.txt", Name{Key: "app.txt", Time: at("2014-04-16 12:00:00.500")}, true},
+		{NAME_TIMESTAMP, "", "app-20140416120000.500.2.txt.gz", Name{Key: "app.txt", Time: at("2014-04-16 12:00:00.500"), Seq: 2}, true},
+		{NAME_TIMESTAMP, "2006-01-02", "access-2014-04-16.12.log", Name{Key: "access.log", Time: at("2014-04-16 00:00:00.000"), Seq: 12}, true},
+		{NAME_TIMESTAMP, "", "other.txt", Name{}, false},
+		{NAME_NUMBERED, "", "app.log", Name{Key: "app.log", Current: true}, true},
+		{NAME_NUMBERED, "", "app.log.12.gz", Name{Key: "app.log", Number: 12}, true},
+		{NAME_NUMBERED, "", "app.log.0.3", Name{Key: "app.log", Seq: 3}, true},
+		{NAME_NUMBERED, "", "current", Name{}, false},
+		{NAME_DATED, "2006-01-02", "app.log.2014-04-16", Name{Key: "app.log", Time: at("2014-04-16 00:00:00.000")}, true},
+		{NAME_DATED, "2006-01-02", "app.log.2014-04-16.2.gz", Name{Key: "app.log", Time: at("2014-04-16 00:00:00.000"), Seq: 2}, true},
+		{NAME_DATED, "", "app.log.20140416120000.500", Name{Key: "app.log", Time: at("2014-04-16 12:00:00.500")}, true},
+		{NAME_DATED, "", "app.log", Name{Key: "app.log", Current: true}, true},
+	} {
+		got, ok := ParseName(c.naming, c.layout, c.base)
+		if ok != c.ok || ok && (got.Key != c.want.Key || !got.Time.Equal(c.want.Time) ||
+			got.Seq != c.want.Seq || got.Number != c.want.Number || got.Current != c.want.Current) {
+			t.Errorf("%s: want %v %v, but got %v %v", c.base, c.want, c.ok, got, ok)
+		}
+	}
+
+	// numbered: .12, .2, .0.1, .0.2, current
+	names := []Name{{Current: true}, {Seq: 2}, {Number: 2}, {Seq: 1}, {Number: 12}}
+	sort.Slice(names, func(i, j int) bool { return names[i].Before(names[j]) })
+	if names[0].Number != 12 || names[1].Number != 2 || names[2].Seq != 1 || names[3].Seq != 2 || !names[4].Current {
+		t.Errorf("unexpected order %v", names)
+	}
+}
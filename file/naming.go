@@ -0,0 +1,209 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Naming schemes of Sets.Naming.
+const (
+	NAME_TIMESTAMP = iota // writes to prefix-<layout>.ext, a new file for each rotation, default
+	NAME_NUMBERED         // writes to name.ext, rotated to name.ext.1, the older ones are shifted to .2, .3 ...
+	NAME_DATED            // writes to name.ext, rotated to name.ext.<layout>
+)
+
+// Name is a file name parsed by ParseName.
+type Name struct {
+	Key     string    // shared by the files of a File, prefix.ext of NAME_TIMESTAMP, name.ext of the others
+	Time    time.Time // time in the name, zero for NAME_NUMBERED and the current file
+	Seq     int       // sequence suffix, or N of the pending name.ext.0.N
+	Number  int       // N of name.ext.N of NAME_NUMBERED, the larger is older
+	Current bool      // the current file name.ext of NAME_NUMBERED and NAME_DATED
+}
+
+// ParseName parses the base name of a file written by the naming scheme and
+// layout, the codec extension is trimmed, the empty layout is DefaultLayout.
+// It returns false if base is not named by the scheme. The files of NAME_NUMBERED
+// and NAME_DATED that are not rotated are parsed as the current file.
+func ParseName(naming int, layout, base string) (Name, bool) {
+	if c := CodecOf(base); c != nil {
+		base = strings.TrimSuffix(base, c.Ext())
+	}
+	if len(layout) == 0 {
+		layout = DefaultLayout
+	}
+	var n Name
+	switch naming {
+	case NAME_TIMESTAMP:
+		i := strings.IndexByte(base, '-')
+		if i <= 0 {
+			return n, false
+		}
+		ext := filepath.Ext(base[i+1:])
+		stamp := base[i+1 : len(base)-len(ext)]
+		if t, seq, ok := parseStamp(layout, stamp); ok {
+			n.Key, n.Time, n.Seq = base[:i]+ext, t, seq
+			return n, true
+		}
+		return n, false
+	case NAME_NUMBERED:
+		if i := strings.LastIndexByte(base, '.'); i > 0 {
+			num, err := strconv.Atoi(base[i+1:])
+			key := base[:i]
+			if err == nil && num > 0 && strings.HasSuffix(key, `.0`) && len(filepath.Ext(key[:len(key)-2])) != 0 {
+				n.Key, n.Seq = key[:len(key)-2], num
+				return n, true
+			}
+			if err == nil && num > 0 && len(filepath.Ext(key)) != 0 {
+				n.Key, n.Number = key, num
+				return n, true
+			}
+		}
+	case NAME_DATED:
+		for i := strings.IndexByte(base, '.'); i != -1; {
+			j := strings.IndexByte(base[i+1:], '.')
+			if j == -1 {
+				break
+			}
+			i += j + 1
+			if t, seq, ok := parseStamp(layout, base[i+1:]); ok {
+				n.Key, n.Time, n.Seq = base[:i], t, seq
+				return n, true
+			}
+		}
+	default:
+		return n, false
+	}
+	n.Key, n.Current = base, true
+	return n, len(filepath.Ext(base)) != 0
+}
+
+// parseStamp parses s formatted by layout and the optional sequence suffix.
+func parseStamp(layout, s string) (time.Time, int, bool) {
+	if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+		return t, 0, true
+	}
+	i := strings.LastIndexByte(s, '.')
+	if i == -1 {
+		return time.Time{}, 0, false
+	}
+	seq, err := strconv.Atoi(s[i+1:])
+	if err != nil || seq <= 0 {
+		return time.Time{}, 0, false
+	}
+	t, err := time.ParseInLocation(layout, s[:i], time.Local)
+	return t, seq, err == nil
+}
+
+// Before reports whether the file n is written before m, both have the same Key.
+func (n Name) Before(m Name) bool {
+	if n.Current != m.Current {
+		return m.Current
+	}
+	if n.Number != m.Number {
+		return n.Number > m.Number
+	}
+	if !n.Time.Equal(m.Time) {
+		return n.Time.Before(m.Time)
+	}
+	return n.Seq < m.Seq
+}
+
+// format returns the name of the time t, the sequence seq is appended if it is not 0.
+func (f *File) format(t time.Time, seq int) string {
+	s := t.Format(f.sets.Layout)
+	if seq != 0 {
+		s += `.` + strconv.Itoa(seq)
+	}
+	if f.sets.Naming == NAME_DATED {
+		return f.Name + `.` + s
+	}
+	return filepath.Join(f.dir, f.prefix+`-`+s+f.ext)
+}
+
+// next returns the first name formatted by now which does not exist.
+// now is advanced by a millisecond for each existing name, the sequence
+// is increased instead if the layout is coarser than the millisecond.
+func (f *File) next(now time.Time) string {
+	prev := ""
+	for seq := 0; ; {
+		name := f.format(now, seq)
+		fi, _ := os.Lstat(name)
+		if fi == nil && name != f.Name {
+			return name
+		}
+		if name == prev {
+			seq++
+		} else {
+			now = now.Add(time.Millisecond)
+		}
+		prev = name
+	}
+}
+
+// pending returns the name which the current file is renamed to by Rotate,
+// e.g. name.ext.0.1, it is renamed to name.ext.1 by shift in the background.
+func (f *File) pending() string {
+	for seq := 1; ; seq++ {
+		name := f.Name + `.0.` + strconv.Itoa(seq)
+		if fi, _ := os.Lstat(name); fi == nil {
+			return name
+		}
+	}
+}
+
+// shift renames name.ext.N to name.ext.N+1 from the largest N, the codec
+// extension is kept, then renames the rotated file old to name.ext.1 and returns it.
+// The returned name is empty if old is not renamed.
+func (f *File) shift(old string) (string, error) {
+	entries, _ := os.ReadDir(f.dir)
+	type numbered struct {
+		n         int
+		name, ext string
+	}
+	var files []numbered
+	base := filepath.Base(f.Name) + `.`
+	for _, e := range entries {
+		name, ext := e.Name(), ""
+		if c := CodecOf(name); c != nil {
+			name, ext = strings.TrimSuffix(name, c.Ext()), c.Ext()
+		}
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+		if n, err := strconv.Atoi(name[len(base):]); err == nil && n > 0 {
+			files = append(files, numbered{n, name, ext})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].n > files[j].n })
+	for _, nf := range files {
+		err := os.Rename(
+			filepath.Join(f.dir, nf.name+nf.ext),
+			filepath.Join(f.dir, base+strconv.Itoa(nf.n+1)+nf.ext),
+		)
+		if err != nil {
+			return "", err
+		}
+	}
+	name := f.Name + `.1`
+	if err := os.Rename(old, name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// link points the symbolic link Sets.Link to the current file, the link is
+// created by a temporary name and renamed, so it is always valid for readers.
+func (f *File) link() error {
+	name := filepath.Join(f.dir, f.sets.Link)
+	tmp := name + `.tmp`
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(f.Name), tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
@@ -0,0 +1,108 @@
+package file
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/typepress/log"
+)
+
+// files is the Files reopened by ReopenAll, from NewSets until Close.
+var files struct {
+	mu sync.Mutex
+	m  map[*File]bool
+}
+
+func register(f *File) {
+	files.mu.Lock()
+	if files.m == nil {
+		files.m = map[*File]bool{}
+	}
+	files.m[f] = true
+	files.mu.Unlock()
+}
+
+func unregister(f *File) {
+	files.mu.Lock()
+	delete(files.m, f)
+	files.mu.Unlock()
+}
+
+// Reopen closes and reopens the current file by its name, e.g. after the
+// file is moved by logrotate. The file is not rotated.
+// The error is reported to Sets.OnError too.
+func (f *File) Reopen() (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return log.ErrClosed
+	}
+	err = f.close()
+	if e := f.open(); e != nil {
+		err = e
+	}
+	f.report(err)
+	return
+}
+
+// ReopenAll reopens all the Files which are not closed, returns the first error.
+func ReopenAll() (err error) {
+	files.mu.Lock()
+	all := make([]*File, 0, len(files.m))
+	for f := range files.m {
+		all = append(all, f)
+	}
+	files.mu.Unlock()
+	for _, f := range all {
+		if e := f.Reopen(); err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// HandleSignals calls ReopenAll on the signals, the default is SIGHUP,
+// e.g. for the postrotate script of logrotate. The returned stop function
+// stops the handler.
+func HandleSignals(sig ...os.Signal) (stop func()) {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, sig...)
+	go func() {
+		for {
+			select {
+			case <-c:
+				ReopenAll()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
+
+// check closes the file if the name is moved, deleted or replaced, then it is
+// reopened by Write. f.fd must not be nil, f.mu must be locked.
+func (f *File) check() {
+	f.checked = time.Now()
+	cur, err := f.fd.Stat()
+	if err != nil {
+		return
+	}
+	if fi, err := os.Stat(f.Name); err == nil && os.SameFile(cur, fi) {
+		return
+	}
+	f.close()
+}
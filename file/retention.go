@@ -0,0 +1,83 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type segment struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// own reports whether base is named by the prefix and ext of f, the file may be compressed.
+func (f *File) own(base string) bool {
+	if c := CodecOf(base); c != nil {
+		base = strings.TrimSuffix(base, c.Ext())
+	}
+	if f.sets.Naming != NAME_TIMESTAMP {
+		return strings.HasPrefix(base, f.prefix+f.ext+`.`)
+	}
+	return strings.HasPrefix(base, f.prefix+`-`) && strings.HasSuffix(base, f.ext)
+}
+
+// segments returns the files to clean up in the directory, newest first.
+// The files modified since since are skipped, the current file may be rotated meanwhile.
+func (f *File) segments(current string, since time.Time) (segs []segment, size int64) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !f.sets.All && !f.own(e.Name()) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		name := filepath.Join(f.dir, e.Name())
+		if name == current {
+			size = fi.Size()
+			continue
+		}
+		if !fi.ModTime().Before(since) {
+			continue
+		}
+		segs = append(segs, segment{name, fi.Size(), fi.ModTime()})
+	}
+	sort.Slice(segs, func(i, j int) bool {
+		if segs[i].modTime.Equal(segs[j].modTime) {
+			return segs[i].name > segs[j].name
+		}
+		return segs[i].modTime.After(segs[j].modTime)
+	})
+	return
+}
+
+// cleanup deletes the rotated files by MaxFiles, MaxAge and MaxBytes, current is never deleted,
+// it is f.Name at the time since. f.cmu must be locked, f.mu must not be locked.
+func (f *File) cleanup(current string, since time.Time) {
+	if f.sets.MaxFiles <= 0 && f.sets.MaxAge <= 0 && f.sets.MaxBytes <= 0 {
+		return
+	}
+	segs, total := f.segments(current, since)
+	var deadline time.Time
+	if f.sets.MaxAge > 0 {
+		deadline = time.Now().Add(-time.Duration(f.sets.MaxAge) * time.Minute)
+	}
+	over := false // the older files are deleted after MaxBytes is reached
+	for i, seg := range segs {
+		over = over || f.sets.MaxBytes > 0 && total+seg.size > f.sets.MaxBytes
+		if over || f.sets.MaxFiles > 0 && i+1 >= f.sets.MaxFiles ||
+			!deadline.IsZero() && seg.modTime.Before(deadline) {
+			os.Remove(seg.name)
+			continue
+		}
+		total += seg.size
+	}
+}
@@ -0,0 +1,148 @@
+package log
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// the settings owned by a named logger, the others are inherited from the parent.
+const (
+	_own_level = 1 << iota
+	_own_flag
+	_own_modes
+	_own_prefix
+	_own_out
+)
+
+// +dl zh-cn
+// 命名 Logger 的设置项, 用于 Inherit 和 Owns.
+// +dl
+
+// settings of a named logger for Inherit and Owns.
+const (
+	INHERIT_LEVEL  = _own_level
+	INHERIT_FLAGS  = _own_flag
+	INHERIT_MODES  = _own_modes
+	INHERIT_PREFIX = _own_prefix
+	INHERIT_OUTPUT = _own_out
+	INHERIT_ALL    = INHERIT_LEVEL | INHERIT_FLAGS | INHERIT_MODES | INHERIT_PREFIX | INHERIT_OUTPUT
+)
+
+var tree struct {
+	mu    sync.Mutex
+	nodes map[string]*logger
+}
+
+// +dl zh-cn
+/*
+  Get 返回以点分隔的命名 Logger, 比如 "db.pool", 不存在时建立它和它的祖先.
+  名称 "" 和 "root" 都表示根 Logger, 缺省输出到 os.Stderr, flags 为 LstdFlags.
+  "root.db" 等同于 "db".
+
+  命名 Logger 继承最近的祖先的 level, flags, modes, prefix 和输出目标,
+  直到对它调用 SetLevel, SetFlags, SetModes, ClearModes, SetPrefix, SetOutput
+  设置了自己的值. 修改祖先的设置会传递给所有继承它的后代, 比如:
+
+	log.Get("db").SetLevel(log.LDebug) // db, db.pool 等都输出 LDebug
+	log.Get("db.pool").SetLevel(log.LError) // 只有 db.pool 及其后代改为 LError
+
+  Inherit 取消命名 Logger 自己的设置, 恢复继承.
+
+  命名 Logger 同时以其名称注册, 根 Logger 的注册名为 "root".
+  没有设置输出目标的命名 Logger 共享祖先的输出, Close 对它无效.
+*/
+// +dl
+
+// Get returns the named logger of dotted name, creates it and its ancestors if missing.
+// A named logger inherits the settings from its nearest ancestor until they are set on it.
+func Get(name string) Logger {
+	name = treeName(name)
+
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	if tree.nodes == nil {
+		root := New(os.Stderr, "", LstdFlags).(*logger)
+		tree.nodes = map[string]*logger{"": root}
+		Register("root", root)
+	}
+	return getNode(name)
+}
+
+// getNode returns the node of name, tree.mu must be locked.
+func getNode(name string) *logger {
+	if l := tree.nodes[name]; l != nil {
+		return l
+	}
+	parent := tree.nodes[""]
+	if i := strings.LastIndexByte(name, '.'); i != -1 {
+		parent = getNode(name[:i])
+	}
+	l := &logger{core: &core{name: name, parent: parent.core}}
+	tree.nodes[name] = l
+	Register(name, l)
+	return l
+}
+
+// treeName returns the name without dots at the ends, and "root" is removed.
+func treeName(name string) string {
+	name = strings.Trim(name, ".")
+	if name == "root" {
+		return ""
+	}
+	return strings.TrimPrefix(name, "root.")
+}
+
+// lookup returns the nearest core owns the setting bit, c owns all settings if it has no parent.
+func (c *core) lookup(bit int32) *core {
+	for c.parent != nil && atomic.LoadInt32(&c.own)&bit == 0 {
+		c = c.parent
+	}
+	return c
+}
+
+// +dl zh-cn
+/*
+  Inherit 取消命名 Logger l 自己的设置 settings, 之后它们再次从祖先继承.
+  settings 是 INHERIT_* 常量的组合. 对根 Logger 和非命名 Logger 无效.
+  取消 INHERIT_OUTPUT 不会关闭 l 自己的输出目标.
+*/
+// +dl
+
+// Inherit clears the own settings of the named logger l, they are inherited from
+// the parent again. It has no effect on the root and the unnamed loggers.
+func Inherit(l Logger, settings int) {
+	if x, ok := l.(*logger); ok && x.parent != nil {
+		x.clearOwn(int32(settings))
+	}
+}
+
+// +dl zh-cn
+// Owns 返回 l 是否拥有全部 settings 设置, 而不是从祖先继承. 根 Logger 和非命名 Logger 拥有全部设置.
+// +dl
+
+// Owns reports whether l has its own settings, instead of inheriting them.
+// The root and the unnamed loggers own all settings.
+func Owns(l Logger, settings int) bool {
+	x, ok := l.(*logger)
+	return !ok || x.parent == nil || atomic.LoadInt32(&x.own)&int32(settings) == int32(settings)
+}
+
+func (c *core) setOwn(bit int32) {
+	for {
+		own := atomic.LoadInt32(&c.own)
+		if own&bit != 0 || atomic.CompareAndSwapInt32(&c.own, own, own|bit) {
+			return
+		}
+	}
+}
+
+func (c *core) clearOwn(bits int32) {
+	for {
+		own := atomic.LoadInt32(&c.own)
+		if own&bits == 0 || atomic.CompareAndSwapInt32(&c.own, own, own&^bits) {
+			return
+		}
+	}
+}
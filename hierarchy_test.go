@@ -0,0 +1,71 @@
+package log
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	t.Cleanup(func() { // the next run starts with a new tree
+		tree.mu.Lock()
+		tree.nodes = nil
+		tree.mu.Unlock()
+	})
+	w := bytes.NewBuffer(nil)
+	root := Get("")
+	if Get("root") != root || Get("root.hierarchy.db") != Get("hierarchy.db.") {
+		t.Fatal("Get returns different loggers of the same name")
+	}
+	if Lookup("root") != root || Lookup("hierarchy.db") != Get("hierarchy.db") {
+		t.Fatal("named loggers are not registered")
+	}
+
+	top := Get("hierarchy")
+	top.SetOutput(w)
+	top.SetFlags(0)
+	top.SetLevel(LInfo)
+	top.SetPrefix("p")
+
+	pool := Get("hierarchy.db.pool")
+	pool.Debug("debug")
+	check(t, w, "")
+	pool.Info("info")
+	check(t, w, `p [I] "info"`)
+
+	// propagation
+	top.SetLevel(LDebug)
+	pool.Debug("debug")
+	check(t, w, `p [D] "debug"`)
+
+	// override
+	db := Get("hierarchy.db")
+	db.SetLevel(LError)
+	db.SetModes(MODE_NONE_NAME)
+	pool.Info("info")
+	check(t, w, "")
+	pool.Error("error")
+	check(t, w, `p "error"`)
+	top.Debug("debug")
+	check(t, w, `p [D] "debug"`)
+	top.SetLevel(LInfo)
+	if pool.Level() != LError || Get("hierarchy.x").Level() != LInfo {
+		t.Error("overridden level is changed by the parent")
+	}
+
+	// inherit again
+	if !Owns(db, INHERIT_LEVEL|INHERIT_MODES) || Owns(pool, INHERIT_LEVEL) || !Owns(root, INHERIT_ALL) {
+		t.Error("unexpected Owns")
+	}
+	Inherit(db, INHERIT_LEVEL|INHERIT_MODES)
+	Inherit(root, INHERIT_ALL)
+	pool.Info("info")
+	check(t, w, `p [I] "info"`)
+	if Owns(db, INHERIT_LEVEL) || !Owns(root, INHERIT_ALL) {
+		t.Error("Inherit failed")
+	}
+
+	// the inherited output is not closed
+	if err := pool.Close(); err != nil {
+		t.Error(err)
+	}
+}
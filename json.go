@@ -0,0 +1,197 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// +dl zh-cn
+/*
+  JSONEncoder 每条记录输出一行 JSON 对象, 使用 MODE_JSON 选择. 依次输出的 key:
+
+	time   Flags 包含 Ldate, Ltime 或 Lmicroseconds 时输出, RFC3339 格式.
+	level  级别名称, 比如 "error".
+	prefix 非空时输出.
+	caller Flags 包含 Lshortfile 或 Llongfile 时输出.
+	msg    日志消息.
+
+  然后是结构化字段. 常见类型的字段值不使用反射.
+*/
+// +dl
+
+// JSONEncoder writes one JSON object per line, selected by MODE_JSON.
+var JSONEncoder Encoder = jsonEncoder{}
+
+type jsonEncoder struct{}
+
+const (
+	rfc3339Micro = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+func (jsonEncoder) Encode(buf []byte, r *Record) []byte {
+	buf = append(buf, '{')
+	if r.Flags&(Ldate|Ltime|Lmicroseconds) != 0 {
+		buf = append(buf, `"time":"`...)
+		if r.Flags&Lmicroseconds != 0 {
+			buf = r.Time.AppendFormat(buf, rfc3339Micro)
+		} else {
+			buf = r.Time.AppendFormat(buf, time.RFC3339)
+		}
+		buf = append(buf, `",`...)
+	}
+
+	buf = append(buf, `"level":`...)
+	buf = appendJSONString(buf, LevelName(r.Level))
+
+	if len(r.Prefix) != 0 {
+		buf = append(buf, `,"prefix":`...)
+		buf = appendJSONString(buf, r.Prefix)
+	}
+	if r.Flags&(Lshortfile|Llongfile) != 0 {
+		buf = append(buf, `,"caller":"`...)
+		buf = appendJSONEscaped(buf, string(r.appendCaller(nil)))
+		buf = append(buf, '"')
+	}
+
+	buf = append(buf, `,"msg":`...)
+	buf = appendJSONString(buf, r.Message)
+
+	for _, f := range r.Fields {
+		buf = append(buf, ',')
+		buf = appendJSONString(buf, f.Key)
+		buf = append(buf, ':')
+		buf = appendJSONValue(buf, f.Value)
+	}
+	return append(buf, '}', '\n')
+}
+
+func appendJSONValue(buf []byte, v interface{}) []byte {
+	switch x := v.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case string:
+		return appendJSONString(buf, x)
+	case bool:
+		return strconv.AppendBool(buf, x)
+	case int:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int8:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int16:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int32:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int64:
+		return strconv.AppendInt(buf, x, 10)
+	case uint:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint8:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint16:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint32:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint64:
+		return strconv.AppendUint(buf, x, 10)
+	case float32:
+		return appendJSONFloat(buf, float64(x), 32)
+	case float64:
+		return appendJSONFloat(buf, x, 64)
+	case []byte:
+		return appendJSONString(buf, string(x))
+	case time.Duration:
+		return appendJSONString(buf, x.String())
+	case time.Time:
+		buf = append(buf, '"')
+		buf = x.AppendFormat(buf, time.RFC3339Nano)
+		return append(buf, '"')
+	case json.Marshaler:
+		b, err := x.MarshalJSON()
+		if err != nil {
+			return appendJSONString(buf, err.Error())
+		}
+		return append(buf, b...)
+	case error:
+		return appendJSONString(buf, x.Error())
+	case fmt.Stringer:
+		return appendJSONString(buf, x.String())
+	}
+
+	// slow path, reflection
+	b, err := json.Marshal(v)
+	if err != nil {
+		return appendJSONString(buf, fmt.Sprint(v))
+	}
+	return append(buf, b...)
+}
+
+// appendJSONFloat writes NaN and Inf as strings, JSON has no literal for them.
+func appendJSONFloat(buf []byte, f float64, bitSize int) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		buf = append(buf, '"')
+		buf = strconv.AppendFloat(buf, f, 'g', -1, bitSize)
+		return append(buf, '"')
+	}
+	return strconv.AppendFloat(buf, f, 'g', -1, bitSize)
+}
+
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	buf = appendJSONEscaped(buf, s)
+	return append(buf, '"')
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONEscaped appends s escaped as JSON string content.
+// invalid UTF-8 is replaced by U+FFFD.
+func appendJSONEscaped(buf []byte, s string) []byte {
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028, U+2029 break JavaScript parsers.
+		if r == '\u2028' || r == '\u2029' {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	return append(buf, s[start:]...)
+}
@@ -35,12 +35,13 @@
 package log
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"runtime"
-	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -77,7 +78,7 @@ const (
 	nr_levels
 )
 
-var levelsName [-nr_levels]string
+var levelsName, levelsText [-nr_levels]string
 
 func init() {
 	levelsName[-LZero] = "[Z]"
@@ -89,6 +90,28 @@ func init() {
 	levelsName[-LNotify] = "[N]"
 	levelsName[-LInfo] = "[I]"
 	levelsName[-LDebug] = "[D]"
+
+	levelsText[-LZero] = "zero"
+	levelsText[-LFatal] = "fatal"
+	levelsText[-LPanic] = "panic"
+	levelsText[-LAlert] = "alert"
+	levelsText[-LError] = "error"
+	levelsText[-LReport] = "report"
+	levelsText[-LNotify] = "notify"
+	levelsText[-LInfo] = "info"
+	levelsText[-LDebug] = "debug"
+}
+
+// +dl zh-cn
+// LevelName 返回级别的小写名称, 比如 LError 返回 "error". 无效级别返回 "".
+// +dl
+
+// LevelName returns the lower case name of level, e.g. "error" for LError.
+func LevelName(level int) string {
+	if level > nr_levels && level <= 0 {
+		return levelsText[-level]
+	}
+	return ""
 }
 
 // +dl zh-cn
@@ -100,6 +123,8 @@ func init() {
   MODE_DONT_EXIT 调用 Fatal/Fatalf 时不执行 os.Exit(1).
   MODE_DONT_PANIC 调用 Panic/Panicf 时不抛出 panic.
   MODE_RECOVER 输出日志时使用 recover() 捕获并忽略 panic.
+  MODE_JSON 使用 JSONEncoder 编码, 每条记录输出一行 JSON.
+  MODE_LOGFMT 使用 LogfmtEncoder 编码, 每条记录输出一行 logfmt.
 */
 
 // +dl
@@ -112,9 +137,19 @@ const (
 	MODE_NONE_EOR                 // send []byte{} on Output.
 	MODE_DONT_EXIT                // dont exec os.Exit when Fatal
 	MODE_DONT_PANIC               // dont exec panic when Panic
+	MODE_JSON                     // use JSONEncoder
+	MODE_LOGFMT                   // use LogfmtEncoder
 	nr_modes
 )
 
+// modeBit returns the bit of MODE_* mode, returns 0 if mode is invalid.
+func modeBit(mode int) int {
+	if mode > nr_modes && mode <= MODE_EQUAL {
+		return 1 << uint(-mode-100)
+	}
+	return 0
+}
+
 const (
 	_equal = 1 << iota
 	_recover
@@ -122,6 +157,8 @@ const (
 	_none_eor
 	_dont_exit
 	_dont_panic
+	_json
+	_logfmt
 )
 
 // level logger interface.
@@ -155,6 +192,40 @@ type BaseLogger interface {
 	Printf(format string, v ...interface{})
 	// SetPrintLevel to binding level for Print/Printf
 	SetPrintLevel(level int)
+
+	// +dl zh-cn
+	/*
+		下列方法在运行时调整 Logger 的设置, 并发安全.
+		派生的 Logger 与原 Logger 共享这些设置.
+		SetLevel 设置级别, 有效范围 LDebug...LZero, 无效值被忽略.
+		SetFlags 替换全部 flags 常量, 0 取消自动生成的前缀.
+		SetModes, ClearModes 设置, 清除 MODE_* 常量.
+		SetOutput 设置输出目标.
+		对 Get 返回的命名 Logger, 调用这些方法后不再继承父 Logger 的相应设置.
+	*/
+	// +dl
+
+	// SetLevel sets the level, the valid range is LDebug...LZero.
+	SetLevel(level int)
+	// Level returns the level.
+	Level() int
+	// SetFlags replaces the flags.
+	SetFlags(flags int)
+	// Flags returns the flags.
+	Flags() int
+	// SetModes sets the MODE_* modes.
+	SetModes(modes ...int)
+	// ClearModes clears the MODE_* modes.
+	ClearModes(modes ...int)
+	// HasMode reports whether the MODE_* mode is set.
+	HasMode(mode int) bool
+	// SetPrefix sets the prefix.
+	SetPrefix(prefix string)
+	// Prefix returns the prefix.
+	Prefix() string
+	// SetOutput sets the destination for output.
+	SetOutput(w io.Writer)
+
 	// +dl zh-cn
 	/*
 		Output 输出日志符串 s.
@@ -174,28 +245,112 @@ type BaseLogger interface {
 		if omit optionLevel, same to LZero, means always output.
 	*/
 	Output(calldepth int, s string, optionLevel ...int) error
+
+	// +dl zh-cn
+	// Enabled 返回 Output 是否会输出 level 级别的日志, 不考虑 SetVModule 的规则.
+	// +dl
+
+	// Enabled reports whether Output writes the level, regardless of SetVModule.
+	Enabled(level int) bool
 }
 
 type Logger interface {
 	BaseLogger
 	io.WriteCloser
+
+	// +dl zh-cn
+	/*
+		With 返回携带结构化字段的派生 Logger, 派生 Logger 与原 Logger 共享输出和设置.
+		参数 kv 为 key, value 交替序列, 也可以直接使用 Field 或 Fields.
+	*/
+	// +dl
+
+	// With returns a derived Logger carrying the key/value fields.
+	With(kv ...interface{}) Logger
+	// WithFields returns a derived Logger carrying the fields.
+	WithFields(fields Fields) Logger
+
+	ContextLogger
 }
 
 var _ Logger = &logger{}
 
 var endOfRecord []byte = []byte{}
 
-type logger struct {
-	mu     sync.Mutex // ensures atomic writes; protects the following fields
-	prefix string     // prefix to write at beginning of each line
-	flag   int        // properties
-	out    io.Writer  // destination for output
-	buf    []byte     // for accumulating text to write
+// +dl zh-cn
+// Field 是附加到每条日志记录的结构化字段, 它不会被合并到日志消息中.
+// +dl
 
-	level int
-	modes int
+// Field is a structured key/value attribute of records.
+type Field struct {
+	Key   string
+	Value interface{}
+}
 
-	printLevel int //
+// Fields is a list of Field.
+type Fields []Field
+
+// the key used when With gets a non-string key or a missing value.
+const badKey = "!BADKEY"
+
+// makeFields converts the With arguments to Fields.
+func makeFields(kv []interface{}) Fields {
+	fields := make(Fields, 0, len(kv)/2)
+	for i := 0; i < len(kv); i++ {
+		switch v := kv[i].(type) {
+		case Field:
+			fields = append(fields, v)
+		case Fields:
+			fields = append(fields, v...)
+		case string:
+			if i+1 < len(kv) {
+				i++
+				fields = append(fields, Field{v, kv[i]})
+			} else {
+				fields = append(fields, Field{badKey, v})
+			}
+		default:
+			fields = append(fields, Field{badKey, v})
+		}
+	}
+	return fields
+}
+
+// joinFields returns a new Fields, never shares the underlying array.
+func joinFields(a, b Fields) Fields {
+	if len(b) == 0 {
+		return a
+	}
+	fields := make(Fields, 0, len(a)+len(b))
+	fields = append(fields, a...)
+	return append(fields, b...)
+}
+
+type logger struct {
+	*core
+	fields Fields // structured fields of derived logger
+}
+
+// core is shared by a logger and the loggers derived from it.
+type core struct {
+	mu      sync.Mutex   // ensures atomic writes; protects the following fields
+	prefix  atomic.Value // string, prefix to write at beginning of each line
+	flag    int32        // properties, atomic
+	out     io.Writer    // destination for output
+	buf     []byte       // for accumulating text to write
+	rec     Record       // reused for each record
+	encoder Encoder      // encodes records to buf, nil means by modes
+	isRW    int32        // atomic, out is RecordWriter
+
+	level int32 // atomic
+	modes int32 // atomic
+
+	printLevel int32 // atomic
+
+	// named logger, see Get.
+	name   string
+	parent *core // nil for the logger returns by New
+	own    int32 // atomic, the _own_* bits of settings overridden
 }
 
 // Cheap integer to fixed-width decimal ASCII.  Give a negative width to avoid zero-padding.
@@ -218,62 +373,6 @@ func itoa(buf *[]byte, i int, wid int) {
 	*buf = append(*buf, b[bp:]...)
 }
 
-func (l *logger) formatHeader(buf *[]byte, t time.Time, file string, line, level int) {
-	if len(l.prefix) != 0 {
-		*buf = append(*buf, l.prefix...)
-		if len(l.prefix) != 0 {
-			*buf = append(*buf, ' ')
-		}
-	}
-
-	if level > nr_levels && level <= 0 && 0 == _none_name&l.modes {
-		*buf = append(*buf, levelsName[-level]...)
-		*buf = append(*buf, ' ')
-	}
-
-	if l.flag&(Ldate|Ltime|Lmicroseconds) != 0 {
-		if l.flag&Ldate != 0 {
-			year, month, day := t.Date()
-			itoa(buf, year, 4)
-			*buf = append(*buf, '-')
-			itoa(buf, int(month), 2)
-			*buf = append(*buf, '-')
-			itoa(buf, day, 2)
-			*buf = append(*buf, ' ')
-		}
-		if l.flag&(Ltime|Lmicroseconds) != 0 {
-			hour, min, sec := t.Clock()
-			itoa(buf, hour, 2)
-			*buf = append(*buf, ':')
-			itoa(buf, min, 2)
-			*buf = append(*buf, ':')
-			itoa(buf, sec, 2)
-			if l.flag&Lmicroseconds != 0 {
-				*buf = append(*buf, '.')
-				itoa(buf, t.Nanosecond()/1e3, 6)
-			}
-			*buf = append(*buf, ' ')
-		}
-	}
-	if l.flag&(Lshortfile|Llongfile) != 0 {
-		if l.flag&Lshortfile != 0 {
-			short := file
-			for i := len(file) - 1; i > 0; i-- {
-				if file[i] == '/' {
-					short = file[i+1:]
-					break
-				}
-			}
-			file = short
-		}
-		*buf = append(*buf, '<')
-		*buf = append(*buf, file...)
-		*buf = append(*buf, ':')
-		itoa(buf, line, -1)
-		*buf = append(*buf, `> `...)
-	}
-}
-
 func printf(format string, v []interface{}) string {
 	if len(format) == 0 {
 		return fmt.Sprint(v...)
@@ -287,57 +386,109 @@ func (l *logger) Output(calldepth int, s string, optionLevel ...int) (err error)
 	if len(optionLevel) != 0 {
 		level = optionLevel[0]
 	}
-	if level >= LZero || 0 != _equal&l.modes && level == l.level || 0 == _equal&l.modes && level >= l.level {
+	return l.output(calldepth+1, s, level, nil)
+}
 
-	} else {
-		return
-	}
-	now := time.Now() // get this early.
-	var file string
-	var line int
-	if len(s) != 0 {
-		s = strconv.Quote(s)
+// output writes the record, the fields extracted from ctx follow the fields of l.
+func (l *logger) output(calldepth int, s string, level int, ctx context.Context) error {
+	if !l.enabled(calldepth, level) {
+		return nil
 	}
-	if l.flag&(Lshortfile|Llongfile) != 0 {
+	r := Record{Time: time.Now(), Level: level, Message: s, Fields: l.fields, ctx: ctx} // get time early.
+	if l.getFlag()&(Lshortfile|Llongfile) != 0 || l.isRecordWriter() {
 		var ok bool
-		_, file, line, ok = runtime.Caller(calldepth)
+		r.PC, r.File, r.Line, ok = runtime.Caller(calldepth)
 		if !ok {
-			file = "???"
-			line = 0
+			r.File = "???"
+			r.Line = 0
 		}
 	}
-	l.mu.Lock()
+	if ctx != nil {
+		r.Fields = joinFields(r.Fields, contextFields(ctx))
+	}
+	return l.write(r)
+}
+
+// enabled reports whether level is enabled for the caller, the SetVModule rule
+// matches the caller replaces the level of l. skip is the same as runtime.Caller
+// called by the caller of enabled. The caller is not looked up if no rule
+// changes the result.
+func (l *logger) enabled(skip, level int) bool {
+	e := l.Enabled(level)
+	v, _ := vmodules.Load().(*vmodule)
+	if v == nil || !e && level < v.min || e && level >= v.max {
+		return e
+	}
+	if rule, ok := callerLevel(skip + 1); ok {
+		return level >= rule
+	}
+	return e
+}
+
+func (l *logger) isRecordWriter() bool {
+	return atomic.LoadInt32(&l.lookup(_own_out).isRW) != 0
+}
+
+// write fills the settings of l to r, and writes r to the output of l.
+func (l *logger) write(r Record) (err error) {
+	modes := l.getModes()
+	w := l.lookup(_own_out)
+	w.mu.Lock()
 	defer func() {
-		l.mu.Unlock()
-		if 0 != _recover&l.modes {
+		w.mu.Unlock()
+		if 0 != _recover&modes {
 			_ = recover() // ignore panic
 		}
 	}()
 
-	if level > LZero {
-		level = l.printLevel
+	if r.Level > LZero {
+		r.Level = int(atomic.LoadInt32(&l.printLevel))
 	}
+	r.Prefix, r.Flags, r.modes = l.getPrefix(), l.getFlag(), modes
+	w.rec = r
 
-	l.buf = l.buf[:0]
+	if rw, ok := w.out.(RecordWriter); ok {
+		return rw.WriteRecord(&w.rec)
+	}
 
-	l.formatHeader(&l.buf, now, file, line, level)
+	w.buf = w.getEncoder(modes).Encode(w.buf[:0], &w.rec)
 
-	l.buf = append(l.buf, s...)
-	if len(s) > 0 && s[len(s)-1] != '\n' {
-		l.buf = append(l.buf, '\n')
-	}
-	_, err = l.out.Write(l.buf)
-	if err == nil && 0 == _none_eor&l.modes {
-		_, err = l.out.Write(endOfRecord)
+	_, err = w.out.Write(w.buf)
+	if err == nil && 0 == _none_eor&modes {
+		_, err = w.out.Write(endOfRecord)
 	}
 	return
 }
 
+func (l *logger) Enabled(level int) bool {
+	return level >= LZero || 0 != _equal&l.getModes() && level == l.getLevel() || 0 == _equal&l.getModes() && level >= l.getLevel()
+}
+
+// getEncoder returns the custom Encoder or the builtin Encoder selected by modes.
+func (c *core) getEncoder(modes int) Encoder {
+	if c.encoder != nil {
+		return c.encoder
+	}
+	if 0 != _json&modes {
+		return JSONEncoder
+	}
+	if 0 != _logfmt&modes {
+		return LogfmtEncoder
+	}
+	return TextEncoder
+}
+
+// Close closes the output if it is io.Closer,
+// the output inherited from the parent of named logger is not closed.
 func (l *logger) Close() error {
+	if l.parent != nil && atomic.LoadInt32(&l.own)&_own_out == 0 {
+		return nil
+	}
+	modes := l.getModes()
 	l.mu.Lock()
 	defer func() {
 		l.mu.Unlock()
-		if 0 != _recover&l.modes {
+		if 0 != _recover&modes {
 			_ = recover() // ignore panic
 		}
 	}()
@@ -349,17 +500,27 @@ func (l *logger) Close() error {
 }
 
 func (l *logger) Write(p []byte) (n int, err error) {
-	l.mu.Lock()
+	modes := l.getModes()
+	w := l.lookup(_own_out)
+	w.mu.Lock()
 	defer func() {
-		l.mu.Unlock()
-		if 0 != _recover&l.modes {
+		w.mu.Unlock()
+		if 0 != _recover&modes {
 			_ = recover() // ignore panic
 		}
 	}()
-	n, err = l.out.Write(p)
+	n, err = w.out.Write(p)
 	return
 }
 
+func (l *logger) With(kv ...interface{}) Logger {
+	return l.WithFields(makeFields(kv))
+}
+
+func (l *logger) WithFields(fields Fields) Logger {
+	return &logger{l.core, joinFields(l.fields, fields)}
+}
+
 func (l *logger) Print(v ...interface{}) {
 	l.Output(2, printf("", v), 1)
 }
@@ -370,84 +531,201 @@ func (l *logger) Printf(format string, v ...interface{}) {
 
 func (l *logger) SetPrintLevel(level int) {
 	if level <= LZero && level > nr_levels {
-		l.mu.Lock()
-		l.printLevel = level
-		l.mu.Unlock()
+		atomic.StoreInt32(&l.printLevel, int32(level))
+	}
+}
+
+func (c *core) getLevel() int {
+	return int(atomic.LoadInt32(&c.lookup(_own_level).level))
+}
+
+func (c *core) getModes() int {
+	return int(atomic.LoadInt32(&c.lookup(_own_modes).modes))
+}
+
+func (c *core) getFlag() int {
+	return int(atomic.LoadInt32(&c.lookup(_own_flag).flag))
+}
+
+func (c *core) getPrefix() string {
+	s, _ := c.lookup(_own_prefix).prefix.Load().(string)
+	return s
+}
+
+func (l *logger) SetLevel(level int) {
+	if level <= LZero && level > nr_levels {
+		atomic.StoreInt32(&l.level, int32(level))
+		l.setOwn(_own_level)
+	}
+}
+
+func (l *logger) Level() int {
+	return l.getLevel()
+}
+
+func (l *logger) SetFlags(flags int) {
+	if flags >= 0 {
+		atomic.StoreInt32(&l.flag, int32(flags))
+		l.setOwn(_own_flag)
+	}
+}
+
+func (l *logger) Flags() int {
+	return l.getFlag()
+}
+
+func (l *logger) SetModes(modes ...int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bits := l.getModes()
+	for _, mode := range modes {
+		bits |= modeBit(mode)
+	}
+	atomic.StoreInt32(&l.modes, int32(bits))
+	l.setOwn(_own_modes)
+}
+
+func (l *logger) ClearModes(modes ...int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bits := l.getModes()
+	for _, mode := range modes {
+		bits &^= modeBit(mode)
+	}
+	atomic.StoreInt32(&l.modes, int32(bits))
+	l.setOwn(_own_modes)
+}
+
+func (l *logger) HasMode(mode int) bool {
+	bit := modeBit(mode)
+	return bit != 0 && 0 != l.getModes()&bit
+}
+
+func (l *logger) SetPrefix(prefix string) {
+	l.prefix.Store(prefix)
+	l.setOwn(_own_prefix)
+}
+
+func (l *logger) Prefix() string {
+	return l.getPrefix()
+}
+
+func (l *logger) SetOutput(w io.Writer) {
+	if w == nil {
+		return
+	}
+	l.mu.Lock()
+	l.setOut(w)
+	l.setOwn(_own_out)
+	l.mu.Unlock()
+}
+
+// setOut sets out, c.mu must be locked or c is not shared.
+func (c *core) setOut(w io.Writer) {
+	c.out = w
+	if _, ok := w.(RecordWriter); ok {
+		atomic.StoreInt32(&c.isRW, 1)
+	} else {
+		atomic.StoreInt32(&c.isRW, 0)
 	}
 }
 
 func (l *logger) Debug(v ...interface{}) {
-	l.Output(2, printf("", v), LDebug)
+	if l.enabled(1, LDebug) {
+		l.Output(2, printf("", v), LDebug)
+	}
 }
 
 func (l *logger) Debugf(format string, v ...interface{}) {
-	l.Output(2, printf(format, v), LDebug)
+	if l.enabled(1, LDebug) {
+		l.Output(2, printf(format, v), LDebug)
+	}
 }
 
 func (l *logger) Info(v ...interface{}) {
-	l.Output(2, printf("", v), LInfo)
+	if l.enabled(1, LInfo) {
+		l.Output(2, printf("", v), LInfo)
+	}
 }
 
 func (l *logger) Infof(format string, v ...interface{}) {
-	l.Output(2, printf(format, v), LInfo)
+	if l.enabled(1, LInfo) {
+		l.Output(2, printf(format, v), LInfo)
+	}
 }
 
 func (l *logger) Notify(v ...interface{}) {
-	l.Output(2, printf("", v), LNotify)
+	if l.enabled(1, LNotify) {
+		l.Output(2, printf("", v), LNotify)
+	}
 }
 
 func (l *logger) Notifyf(format string, v ...interface{}) {
-	l.Output(2, printf(format, v), LNotify)
+	if l.enabled(1, LNotify) {
+		l.Output(2, printf(format, v), LNotify)
+	}
 }
 
 func (l *logger) Report(v ...interface{}) {
-	l.Output(2, printf("", v), LReport)
+	if l.enabled(1, LReport) {
+		l.Output(2, printf("", v), LReport)
+	}
 }
 
 func (l *logger) Reportf(format string, v ...interface{}) {
-	l.Output(2, printf(format, v), LReport)
+	if l.enabled(1, LReport) {
+		l.Output(2, printf(format, v), LReport)
+	}
 }
 
 func (l *logger) Error(v ...interface{}) {
-	l.Output(2, printf("", v), LError)
+	if l.enabled(1, LError) {
+		l.Output(2, printf("", v), LError)
+	}
 }
 
 func (l *logger) Errorf(format string, v ...interface{}) {
-	l.Output(2, printf(format, v), LError)
+	if l.enabled(1, LError) {
+		l.Output(2, printf(format, v), LError)
+	}
 }
 
 func (l *logger) Alert(v ...interface{}) {
-	l.Output(2, printf("", v), LAlert)
+	if l.enabled(1, LAlert) {
+		l.Output(2, printf("", v), LAlert)
+	}
 }
 
 func (l *logger) Alertf(format string, v ...interface{}) {
-	l.Output(2, printf(format, v), LAlert)
+	if l.enabled(1, LAlert) {
+		l.Output(2, printf(format, v), LAlert)
+	}
 }
 
 func (l *logger) Panic(v ...interface{}) {
 	l.Output(2, printf("", v), LPanic)
-	if 0 == _dont_panic&l.modes {
+	if 0 == _dont_panic&l.getModes() {
 		panic(v)
 	}
 }
 
 func (l *logger) Panicf(format string, v ...interface{}) {
 	l.Output(2, printf(format, v), LPanic)
-	if 0 == _dont_panic&l.modes {
+	if 0 == _dont_panic&l.getModes() {
 		panic(v)
 	}
 }
 
 func (l *logger) Fatal(v ...interface{}) {
 	l.Output(2, printf("", v), LFatal)
-	if 0 == _dont_exit&l.modes {
+	if 0 == _dont_exit&l.getModes() {
 		os.Exit(1)
 	}
 }
 
 func (l *logger) Fatalf(format string, v ...interface{}) {
 	l.Output(2, printf(format, v), LFatal)
-	if 0 == _dont_exit&l.modes {
+	if 0 == _dont_exit&l.getModes() {
 		os.Exit(1)
 	}
 }
@@ -468,38 +746,49 @@ func (l *logger) Fatalf(format string, v ...interface{}) {
   flags The valid range includes all flags constants.
 */
 func New(writer io.Writer, prefix string, flags ...int) Logger {
+	return NewWithEncoder(writer, prefix, nil, flags...)
+}
+
+// +dl zh-cn
+/*
+  NewWithEncoder 与 New 相同, 但使用 enc 替代缺省的 TextEncoder.
+  enc 为 nil 时与 New 相同, 由 MODE_JSON, MODE_LOGFMT 选择 Encoder.
+*/
+// +dl
+
+// NewWithEncoder is New with the Encoder enc, nil enc is the same as New.
+func NewWithEncoder(writer io.Writer, prefix string, enc Encoder, flags ...int) Logger {
 	if writer == nil {
 		return nil
 	}
-	ret := new(logger)
-	ret.level = nr_levels
+	ret := &logger{core: new(core)}
+	ret.encoder = enc
+	level, modes, flag := nr_levels, 0, 0
 	hasflags := false
-	for _, flag := range flags {
-
-		if flag > nr_modes && flag <= MODE_EQUAL {
-			flag = -flag - 100
-			ret.modes = ret.modes | 1<<uint(flag)
+	for _, f := range flags {
+		if bit := modeBit(f); bit != 0 {
+			modes = modes | bit
 			continue
 		}
 
-		if flag >= 0 {
+		if f >= 0 {
 			hasflags = true
-			ret.flag = ret.flag | flag
+			flag = flag | f
 		} else {
-			ret.level = flag
+			level = f
 		}
 	}
 	// defaults to LstdFlags.
 	if !hasflags {
-		ret.flag = LstdFlags
+		flag = LstdFlags
 	}
 
-	if ret.level <= nr_levels {
-		ret.level = nr_levels + 1
+	if level <= nr_levels {
+		level = nr_levels + 1
 	}
 
-	ret.prefix = prefix
-	ret.out = writer
-
+	ret.level, ret.modes, ret.flag = int32(level), int32(modes), int32(flag)
+	ret.prefix.Store(prefix)
+	ret.setOut(writer)
 	return ret
 }
@@ -58,3 +58,37 @@ func check(t *testing.T, w *bytes.Buffer, want string) {
 		t.Errorf("want: %#v, but got: %#v", want, got)
 	}
 }
+
+func TestSetters(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	l := New(w, "", 0, LError)
+	d := l.With("k", 1)
+
+	l.Debug("debug")
+	check(t, w, "")
+
+	l.SetLevel(LDebug)
+	if l.Level() != LDebug {
+		t.Errorf("want LDebug, but got: %d", l.Level())
+	}
+	d.Debug("debug")
+	check(t, w, `[D] "debug" k=1`)
+
+	l.SetModes(MODE_NONE_NAME, MODE_EQUAL)
+	if !d.HasMode(MODE_NONE_NAME) || !l.HasMode(MODE_EQUAL) || l.HasMode(MODE_JSON) {
+		t.Error("SetModes failed")
+	}
+	l.Error("error")
+	check(t, w, "")
+	l.Debug("debug")
+	check(t, w, `"debug"`)
+
+	l.ClearModes(MODE_NONE_NAME, MODE_EQUAL)
+	l.SetPrefix("p")
+	l.SetFlags(Lshortfile)
+	l.Error("error")
+	check(t, w, `p [E] <log_test.go:89> "error"`)
+	if l.Prefix() != "p" || l.Flags() != Lshortfile {
+		t.Error("SetPrefix or SetFlags failed")
+	}
+}
@@ -0,0 +1,167 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// +dl zh-cn
+/*
+  LogfmtEncoder 每条记录输出一行 logfmt, 使用 MODE_LOGFMT 选择. 格式为:
+
+	time=2014-02-18T17:30:27+08:00 level=error prefix=db caller=hello.go:25 msg="message" key=value
+
+  time, prefix, caller 的输出规则与 JSONEncoder 相同.
+  值只在需要时才被引号包裹, 嵌套的 Field, Fields 展开为 "key.sub=value",
+  map, slice 等其他类型的值以 JSON 格式输出.
+*/
+// +dl
+
+// LogfmtEncoder writes one logfmt line per record, selected by MODE_LOGFMT.
+var LogfmtEncoder Encoder = logfmtEncoder{}
+
+type logfmtEncoder struct{}
+
+func (logfmtEncoder) Encode(buf []byte, r *Record) []byte {
+	if r.Flags&(Ldate|Ltime|Lmicroseconds) != 0 {
+		buf = append(buf, "time="...)
+		if r.Flags&Lmicroseconds != 0 {
+			buf = r.Time.AppendFormat(buf, rfc3339Micro)
+		} else {
+			buf = r.Time.AppendFormat(buf, time.RFC3339)
+		}
+		buf = append(buf, ' ')
+	}
+
+	buf = append(buf, "level="...)
+	buf = append(buf, LevelName(r.Level)...)
+
+	if len(r.Prefix) != 0 {
+		buf = append(buf, " prefix="...)
+		buf = appendLogfmtString(buf, r.Prefix)
+	}
+	if r.Flags&(Lshortfile|Llongfile) != 0 {
+		buf = append(buf, " caller="...)
+		buf = appendLogfmtString(buf, string(r.appendCaller(nil)))
+	}
+
+	buf = append(buf, " msg="...)
+	buf = appendLogfmtString(buf, r.Message)
+
+	for _, f := range r.Fields {
+		buf = appendLogfmtField(buf, "", f)
+	}
+	return append(buf, '\n')
+}
+
+func appendLogfmtField(buf []byte, group string, f Field) []byte {
+	key := f.Key
+	if len(group) != 0 {
+		key = group + "." + key
+	}
+	switch x := f.Value.(type) {
+	case Field:
+		return appendLogfmtField(buf, key, x)
+	case Fields:
+		for _, sub := range x {
+			buf = appendLogfmtField(buf, key, sub)
+		}
+		return buf
+	}
+	buf = append(buf, ' ')
+	buf = appendLogfmtKey(buf, key)
+	buf = append(buf, '=')
+	return appendLogfmtValue(buf, f.Value)
+}
+
+// appendLogfmtKey replaces the characters which are invalid in key by '_'.
+func appendLogfmtKey(buf []byte, key string) []byte {
+	if len(key) == 0 {
+		return append(buf, '_')
+	}
+	for _, c := range key {
+		if c <= ' ' || c == '=' || c == '"' || c == utf8.RuneError || !unicode.IsPrint(c) {
+			buf = append(buf, '_')
+		} else {
+			buf = utf8.AppendRune(buf, c)
+		}
+	}
+	return buf
+}
+
+func appendLogfmtValue(buf []byte, v interface{}) []byte {
+	switch x := v.(type) {
+	case nil:
+		return append(buf, "nil"...)
+	case string:
+		return appendLogfmtString(buf, x)
+	case bool:
+		return strconv.AppendBool(buf, x)
+	case int:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int8:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int16:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int32:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int64:
+		return strconv.AppendInt(buf, x, 10)
+	case uint:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint8:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint16:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint32:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint64:
+		return strconv.AppendUint(buf, x, 10)
+	case float32:
+		return strconv.AppendFloat(buf, float64(x), 'g', -1, 32)
+	case float64:
+		return strconv.AppendFloat(buf, x, 'g', -1, 64)
+	case []byte:
+		return appendLogfmtString(buf, string(x))
+	case time.Duration:
+		return append(buf, x.String()...)
+	case time.Time:
+		return x.AppendFormat(buf, time.RFC3339Nano)
+	case error:
+		return appendLogfmtString(buf, x.Error())
+	case fmt.Stringer:
+		return appendLogfmtString(buf, x.String())
+	}
+
+	// nested or unsupported values
+	b, err := json.Marshal(v)
+	if err != nil {
+		return appendLogfmtString(buf, fmt.Sprint(v))
+	}
+	return appendLogfmtString(buf, string(b))
+}
+
+// appendLogfmtString quotes s only when needed.
+func appendLogfmtString(buf []byte, s string) []byte {
+	if needsQuote(s) {
+		return strconv.AppendQuote(buf, s)
+	}
+	return append(buf, s...)
+}
+
+func needsQuote(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for _, c := range s {
+		if c <= ' ' || c == '=' || c == '"' || c == '\\' ||
+			c == utf8.RuneError || !unicode.IsPrint(c) {
+			return true
+		}
+	}
+	return false
+}
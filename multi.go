@@ -33,6 +33,7 @@ import (
 // Loggers interface for set of Logger.
 type Loggers interface {
 	LevelLogger
+	ContextLogger
 
 	// +dl zh-cn
 	// Join 增加 Logger 到 Loggers 集合.
@@ -41,6 +42,19 @@ type Loggers interface {
 	// Join logger to Loggers.
 	Join(...Logger)
 	Close()
+
+	// Loggers returns a copy of the joined loggers.
+	Loggers() []Logger
+
+	// +dl zh-cn
+	// With 返回新的 Loggers, 其中每一个 Logger 都是调用 Logger.With 派生的.
+	// 之后对原 Loggers 的 Join 不影响派生的 Loggers.
+	// +dl
+
+	// With returns Loggers of the derived loggers by Logger.With.
+	With(kv ...interface{}) Loggers
+	// WithFields returns Loggers of the derived loggers by Logger.WithFields.
+	WithFields(fields Fields) Loggers
 }
 
 type multi struct {
@@ -79,6 +93,28 @@ func (self *multi) Join(logger ...Logger) {
 	self.loggers = append(self.loggers, logger...)
 }
 
+func (self *multi) Loggers() []Logger {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return append([]Logger(nil), self.loggers...)
+}
+
+func (self *multi) With(kv ...interface{}) Loggers {
+	return self.WithFields(makeFields(kv))
+}
+
+func (self *multi) WithFields(fields Fields) Loggers {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	loggers := make([]Logger, len(self.loggers))
+	for i, l := range self.loggers {
+		if l != nil {
+			loggers[i] = l.WithFields(fields)
+		}
+	}
+	return &multi{sync.RWMutex{}, loggers}
+}
+
 func (self *multi) output(s string, level int) {
 	self.mu.RLock()
 	defer self.mu.RUnlock()
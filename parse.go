@@ -0,0 +1,315 @@
+package log
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// +dl zh-cn
+// ErrSyntax 表示日志行不符合 TextEncoder 的格式.
+// +dl
+
+// ErrSyntax is returned when a line is not in the TextEncoder format.
+var ErrSyntax = errors.New("log: invalid record syntax")
+
+// +dl zh-cn
+// ParseLevel 解析级别名称, 支持 "error", "E", "[E]" 三种形式, 不区分大小写.
+// +dl
+
+// ParseLevel returns the level of name, e.g. "error", "E" or "[E]".
+func ParseLevel(name string) (int, error) {
+	s := strings.ToLower(strings.TrimSpace(name))
+	if len(s) == 3 && s[0] == '[' && s[2] == ']' {
+		s = s[1:2]
+	}
+	for i, text := range levelsText {
+		if s == text || len(s) == 1 && s[0] == text[0] {
+			return -i, nil
+		}
+	}
+	return 0, errors.New("log: unknown level " + strconv.Quote(name))
+}
+
+// +dl zh-cn
+/*
+  Parse 解析 TextEncoder 输出的一行日志, 返回 Record.
+  Record.Flags 是从日志行中检测到的 flags,
+  没有时间部分的 Ldate 或 Ltime 在 Record.Time 中为零值.
+  没有级别缩写前缀的行, Level 为 LZero, 并且 Record.HasMode(MODE_NONE_NAME) 为 true.
+  Message 已经去掉了 strconv.Quote 引号. 字段值按照 bool, int64, float64, string 的顺序识别.
+*/
+// +dl
+
+// Parse parses a line written by TextEncoder.
+func Parse(line string) (*Record, error) {
+	line = strings.TrimRight(line, "\r\n")
+	r := new(Record)
+	if parseRecord(r, line) {
+		return r, nil
+	}
+	// the prefix may contain spaces, try it one by one.
+	for i := 0; i < len(line); i++ {
+		if line[i] != ' ' {
+			continue
+		}
+		*r = Record{}
+		if parseRecord(r, line[i+1:]) {
+			r.Prefix = line[:i]
+			return r, nil
+		}
+	}
+	return nil, ErrSyntax
+}
+
+func parseRecord(r *Record, s string) bool {
+	var year, month, day, hour, min, sec, nsec int
+
+	if len(s) >= 4 && s[0] == '[' && s[2] == ']' && s[3] == ' ' {
+		level, err := ParseLevel(s[:3])
+		if err != nil {
+			return false
+		}
+		r.Level = level
+		s = s[4:]
+	} else {
+		r.Level = LZero
+		r.modes |= _none_name
+	}
+
+	if len(s) >= 11 && s[4] == '-' && s[7] == '-' && s[10] == ' ' {
+		var ok bool
+		if year, ok = atoi(s[:4]); !ok {
+			return false
+		}
+		if month, ok = atoi(s[5:7]); !ok {
+			return false
+		}
+		if day, ok = atoi(s[8:10]); !ok {
+			return false
+		}
+		r.Flags |= Ldate
+		s = s[11:]
+	}
+
+	if len(s) >= 9 && s[2] == ':' && s[5] == ':' {
+		var ok bool
+		if hour, ok = atoi(s[:2]); !ok {
+			return false
+		}
+		if min, ok = atoi(s[3:5]); !ok {
+			return false
+		}
+		if sec, ok = atoi(s[6:8]); !ok {
+			return false
+		}
+		s = s[8:]
+		if len(s) >= 8 && s[0] == '.' {
+			usec, ok := atoi(s[1:7])
+			if !ok {
+				return false
+			}
+			nsec = usec * 1e3
+			r.Flags |= Lmicroseconds
+			s = s[7:]
+		}
+		r.Flags |= Ltime
+		if len(s) == 0 || s[0] != ' ' {
+			return false
+		}
+		s = s[1:]
+	}
+
+	if r.Flags&(Ldate|Ltime|Lmicroseconds) != 0 {
+		if r.Flags&Ldate == 0 {
+			year, month, day = 0, 1, 1
+		}
+		r.Time = time.Date(year, time.Month(month), day, hour, min, sec, nsec, time.Local)
+	}
+
+	if len(s) != 0 && s[0] == '<' {
+		end := strings.Index(s, "> ")
+		if end == -1 {
+			return false
+		}
+		caller := s[1:end]
+		colon := strings.LastIndex(caller, ":")
+		if colon == -1 {
+			return false
+		}
+		line, ok := atoi(caller[colon+1:])
+		if !ok {
+			return false
+		}
+		r.File, r.Line = caller[:colon], line
+		if strings.Contains(r.File, "/") {
+			r.Flags |= Llongfile
+		} else {
+			r.Flags |= Lshortfile
+		}
+		s = s[end+2:]
+	}
+
+	if len(s) != 0 && s[0] == '"' {
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return false
+		}
+		r.Message, _ = strconv.Unquote(quoted)
+		s = s[len(quoted):]
+	} else if len(s) != 0 && s[0] != ' ' {
+		s = " " + s // the fields follow the header directly without the message
+	}
+	return parseFields(r, s)
+}
+
+// parseFields parses " key=value" pairs.
+func parseFields(r *Record, s string) bool {
+	for len(s) != 0 {
+		if s[0] != ' ' {
+			return false
+		}
+		s = s[1:]
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || strings.IndexByte(s[:eq], ' ') != -1 {
+			return false
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+
+		var value interface{}
+		if len(s) != 0 && s[0] == '"' {
+			quoted, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return false
+			}
+			value, _ = strconv.Unquote(quoted)
+			s = s[len(quoted):]
+		} else {
+			end := strings.IndexByte(s, ' ')
+			if end == -1 {
+				end = len(s)
+			}
+			value = parseValue(s[:end])
+			s = s[end:]
+		}
+		r.Fields = append(r.Fields, Field{key, value})
+	}
+	return true
+}
+
+func parseValue(s string) interface{} {
+	if s == "nil" {
+		return nil
+	}
+	if s == "true" || s == "false" {
+		return s == "true"
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// atoi parses the fixed-width decimal written by itoa.
+func atoi(s string) (int, bool) {
+	if len(s) == 0 {
+		return 0, false
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+// +dl zh-cn
+/*
+  Scanner 逐行读取 TextEncoder 格式的日志. 用法:
+
+	s := log.NewScanner(r)
+	for s.Scan() {
+		rec, err := s.Record()
+		...
+	}
+	if s.Err() != nil {
+		...
+	}
+*/
+// +dl
+
+// Scanner reads records in the TextEncoder format line by line.
+type Scanner struct {
+	sc    *bufio.Scanner
+	rec   *Record
+	err   error
+	flags int
+}
+
+// maxLineSize is the maximum size of a line for Scanner.
+const maxLineSize = 16 << 20
+
+// NewScanner returns a new Scanner to read from r.
+func NewScanner(r io.Reader) *Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxLineSize)
+	return &Scanner{sc: sc}
+}
+
+// +dl zh-cn
+// Scan 读取下一行, 读到结尾或者发生 I/O 错误时返回 false.
+// 空行被忽略.
+// +dl
+
+// Scan advances to the next non-empty line.
+func (s *Scanner) Scan() bool {
+	for s.sc.Scan() {
+		line := s.sc.Text()
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		s.rec, s.err = Parse(line)
+		if s.err == nil {
+			s.flags |= s.rec.Flags
+		}
+		return true
+	}
+	return false
+}
+
+// +dl zh-cn
+// Record 返回当前行解析的结果, 不符合格式的行返回 ErrSyntax.
+// +dl
+
+// Record returns the Record of current line, or ErrSyntax.
+func (s *Scanner) Record() (*Record, error) {
+	return s.rec, s.err
+}
+
+// Text returns the current line.
+func (s *Scanner) Text() string {
+	return s.sc.Text()
+}
+
+// +dl zh-cn
+// Flags 返回目前为止检测到的所有 flags.
+// +dl
+
+// Flags returns the union of flags detected so far.
+func (s *Scanner) Flags() int {
+	return s.flags
+}
+
+// Err returns the first non-EOF I/O error.
+func (s *Scanner) Err() error {
+	return s.sc.Err()
+}
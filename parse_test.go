@@ -0,0 +1,75 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	l := New(w, "my app", LstdFlags|Lmicroseconds|Lshortfile)
+	l.With("id", 7, "ok", true, "name", "a b").Error("line1\n\"quoted\"")
+	l = New(w, "", Ldate|Llongfile, MODE_NONE_NAME)
+	l.Info("no name")
+	w.WriteString("raw line\n")
+
+	s := NewScanner(w)
+	if !s.Scan() {
+		t.Fatal("scan failed")
+	}
+	r, err := s.Record()
+	if err != nil {
+		t.Fatal(err, s.Text())
+	}
+	if r.Prefix != "my app" || r.Level != LError || r.Message != "line1\n\"quoted\"" ||
+		r.File != "parse_test.go" || r.Flags != LstdFlags|Lmicroseconds|Lshortfile {
+		t.Errorf("unexpected: %#v", r)
+	}
+	if time.Since(r.Time) > time.Minute {
+		t.Errorf("unexpected time: %v", r.Time)
+	}
+	if len(r.Fields) != 3 || r.Fields[0].Value != int64(7) || r.Fields[1].Value != true ||
+		r.Fields[2].Value != "a b" {
+		t.Errorf("unexpected fields: %#v", r.Fields)
+	}
+
+	s.Scan()
+	r, err = s.Record()
+	if err != nil {
+		t.Fatal(err, s.Text())
+	}
+	if r.Level != LZero || !r.HasMode(MODE_NONE_NAME) || r.Message != "no name" ||
+		!strings.HasSuffix(r.File, "/parse_test.go") || r.Flags != Ldate|Llongfile {
+		t.Errorf("unexpected: %#v", r)
+	}
+
+	s.Scan()
+	if _, err = s.Record(); err != ErrSyntax {
+		t.Errorf("want ErrSyntax, but got: %v", err)
+	}
+	if s.Scan() || s.Err() != nil {
+		t.Error("want EOF")
+	}
+	if s.Flags() != LstdFlags|Lmicroseconds|Lshortfile|Llongfile {
+		t.Errorf("unexpected flags: %d", s.Flags())
+	}
+
+	// 0 and 1 are integers, not booleans
+	w.Reset()
+	New(w, "", 0).With("zero", 0, "one", 1, "no", false).Info("")
+	if r, err = Parse(w.String()); err != nil {
+		t.Fatal(err, w.String())
+	}
+	if len(r.Fields) != 3 || r.Fields[0].Value != int64(0) || r.Fields[1].Value != int64(1) ||
+		r.Fields[2].Value != false {
+		t.Errorf("unexpected fields: %#v", r.Fields)
+	}
+
+	for _, name := range []string{"error", "E", "[E]", "ERROR"} {
+		if level, err := ParseLevel(name); err != nil || level != LError {
+			t.Errorf("ParseLevel(%q) = %d, %v", name, level, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package log
+
+import (
+	"sort"
+	"sync"
+)
+
+var registry struct {
+	mu sync.RWMutex
+	m  map[string]interface{} // Logger or Loggers
+}
+
+// +dl zh-cn
+/*
+  Register 以 name 注册 Logger, 已注册的同名 Logger 或 Loggers 被替换.
+  注册后可以通过 Names, Lookup 枚举和查找, 比如 admin 包的 HTTP 管理接口.
+*/
+// +dl
+
+// Register registers the Logger by name, replaces the old one of the same name.
+func Register(name string, l Logger) {
+	if l != nil {
+		register(name, l)
+	}
+}
+
+// +dl zh-cn
+// RegisterLoggers 以 name 注册 Loggers, 已注册的同名 Logger 或 Loggers 被替换.
+// +dl
+
+// RegisterLoggers registers the Loggers by name, replaces the old one of the same name.
+func RegisterLoggers(name string, m Loggers) {
+	if m != nil {
+		register(name, m)
+	}
+}
+
+func register(name string, v interface{}) {
+	registry.mu.Lock()
+	if registry.m == nil {
+		registry.m = map[string]interface{}{}
+	}
+	registry.m[name] = v
+	registry.mu.Unlock()
+}
+
+// Unregister removes the Logger or Loggers of name.
+func Unregister(name string) {
+	registry.mu.Lock()
+	delete(registry.m, name)
+	registry.mu.Unlock()
+}
+
+// Names returns the sorted names of registered Logger and Loggers.
+func Names() []string {
+	registry.mu.RLock()
+	names := make([]string, 0, len(registry.m))
+	for name := range registry.m {
+		names = append(names, name)
+	}
+	registry.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the registered Logger of name, or nil.
+func Lookup(name string) Logger {
+	registry.mu.RLock()
+	l, _ := registry.m[name].(Logger)
+	registry.mu.RUnlock()
+	return l
+}
+
+// LookupLoggers returns the registered Loggers of name, or nil.
+func LookupLoggers(name string) Loggers {
+	registry.mu.RLock()
+	m, _ := registry.m[name].(Loggers)
+	registry.mu.RUnlock()
+	return m
+}
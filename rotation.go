@@ -2,6 +2,7 @@ package log
 
 import (
 	"io"
+	"sync"
 	"time"
 )
 
@@ -11,26 +12,72 @@ type RotateWriter interface {
 	Rotate(begin, now time.Time)
 }
 
+// +dl zh-cn
+// RotateErrWriter 是 Rotate 方法返回 error 的 RotateWriter, 比如 file.File, 用于 RotateErr.
+// +dl
+
+// RotateErrWriter is the RotateWriter which returns the error of Rotate, such as file.File.
+type RotateErrWriter interface {
+	io.Writer
+	Rotate(begin, now time.Time) error
+}
+
+// noErrWriter adapts RotateWriter to RotateErrWriter, Close closes the RotateWriter if it is io.Closer.
+type noErrWriter struct {
+	RotateWriter
+}
+
+func (w noErrWriter) Rotate(begin, now time.Time) error {
+	w.RotateWriter.Rotate(begin, now)
+	return nil
+}
+
+func (w noErrWriter) Close() error {
+	if c, ok := w.RotateWriter.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 type rotate struct {
-	w                   RotateWriter
+	mu                  sync.Mutex // serializes Write and Rotate
+	w                   RotateErrWriter
+	onError             func(error)
 	maxSize, maxRecodes int
 	minutes             int64
+	schedule            Schedule
 	size, recodes       int
-	seconds             int64
+	next                time.Time // zero if no time condition
 	begin               time.Time
+
+	done   chan struct{} // nil if no timer
+	exited chan struct{}
+	once   sync.Once
 }
 
-func (r *rotate) Close() {
-	c, ok := r.w.(io.Closer)
-	if ok {
-		c.Close()
-	}
+// Close stops the timer and closes the RotateWriter if it is io.Closer.
+func (r *rotate) Close() (err error) {
+	r.once.Do(func() {
+		if r.done != nil {
+			close(r.done)
+			<-r.exited
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if c, ok := r.w.(io.Closer); ok {
+			err = c.Close()
+		}
+	})
+	return
 }
 
 func (r *rotate) Write(p []byte) (n int, err error) {
 	var now time.Time
 	var do bool
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	// 特别的 p==nil 也执行 Write, 可以满足一些特殊需求
 	if p == nil || len(p) != 0 {
 		n, err = r.w.Write(p)
@@ -48,29 +95,95 @@ func (r *rotate) Write(p []byte) (n int, err error) {
 			do = true
 		}
 	}
-	if do || r.minutes > 0 {
+	if do || !r.next.IsZero() {
 		now = time.Now()
 	}
-	if !do && r.minutes > 0 && now.Unix() >= r.seconds {
-		do = true
+	var e error
+	if do {
+		e = r.rotate(now, now)
+	} else {
+		e = r.expire(now)
+	}
+	if err == nil {
+		err = e
 	}
+	return
+}
 
-	if do {
-		begin, to := r.begin, now
-		r.begin = now
-		r.size = 0
-		r.recodes = 0
-		if r.minutes > 0 {
-			r.seconds = now.Add(time.Duration(r.minutes * int64(time.Minute))).Unix()
+// expire rotates if the time condition expires, r.mu must be locked.
+func (r *rotate) expire(now time.Time) error {
+	if r.next.IsZero() || now.Before(r.next) {
+		return nil
+	}
+	to := now
+	if r.schedule != nil {
+		to = r.boundary(now)
+	}
+	return r.rotate(now, to)
+}
+
+// rotate calls RotateWriter.Rotate, r.mu must be locked.
+func (r *rotate) rotate(now, to time.Time) error {
+	begin := r.begin
+	r.begin = to
+	r.size = 0
+	r.recodes = 0
+	r.next = r.nextTime(now)
+	return r.w.Rotate(begin, to)
+}
+
+// run checks the time condition without writing, until Close.
+func (r *rotate) run() {
+	defer close(r.exited)
+	for {
+		r.mu.Lock()
+		next := r.next
+		r.mu.Unlock()
+
+		// wakes up at least every minute, in case the wall clock is changed.
+		wait := time.Minute
+		if d := time.Until(next); !next.IsZero() && d < wait {
+			wait = d
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case now := <-timer.C:
+			r.mu.Lock()
+			err := r.expire(now) // no Write to return the error
+			r.mu.Unlock()
+			if err != nil && r.onError != nil {
+				r.onError(err)
+			}
+		case <-r.done:
+			timer.Stop()
+			return
 		}
-		r.w.Rotate(begin, to)
 	}
-	return
+}
+
+// nextTime returns the time of the next rotation after now.
+func (r *rotate) nextTime(now time.Time) time.Time {
+	if r.schedule != nil {
+		return r.schedule.Next(now)
+	}
+	if r.minutes > 0 {
+		return now.Add(time.Duration(r.minutes * int64(time.Minute)))
+	}
+	return time.Time{}
+}
+
+// boundary returns the latest scheduled time not after now.
+func (r *rotate) boundary(now time.Time) time.Time {
+	b := r.next
+	for n := r.schedule.Next(b); !n.IsZero() && !n.After(now); n = r.schedule.Next(n) {
+		b = n
+	}
+	return b
 }
 
 // +dl zh-cn
-// Rotate 包装 RotateWriter 对象, 返回 io.Writer. 当达到分割条件 RotateWriter.Rotate 被调用.
-// 具体分割行为由 RotateWriter 对象自己完成.
+// Rotate 包装 RotateWriter 对象, 返回 io.WriteCloser. 当达到分割条件 RotateWriter.Rotate 被调用.
+// 具体分割行为由 RotateWriter 对象自己完成. Rotate 方法返回 error 的对象使用 RotateErr.
 //
 // 当 RotateSets 属性值为 0 时, 采用下述缺省值
 //
@@ -79,16 +192,33 @@ func (r *rotate) Write(p []byte) (n int, err error) {
 //   Minutes 60*24*7 7days
 //
 // 当 RotateSets 属性值小于 0 时, 表示忽略此属性.
+//
+// Schedule 非空时按日历对齐的时间分割, 替代 Minutes, 格式见 ParseSchedule.
+// Location 为时区名称, 比如 "Asia/Shanghai", 空值表示 time.Local.
+// Weekday 用于 weekly, 0 表示星期日. 按 Schedule 分割时, Rotate 的参数 now 为对齐的分割时间,
+// 比如 daily 时 file.File 每天产生一个以 00:00 命名的文件.
+// Schedule 或 Location 无效时忽略 Schedule, 该错误报告给 OnError, 也可以先用 RotateSets.Validate 检查.
+//
+// Timer 为 true 时, 后台 goroutine 在时间条件到期时调用 RotateWriter.Rotate,
+// 即使没有写入, 比如让 smtp.Smtp 按时发送. Close 停止 goroutine, 然后关闭 RotateWriter.
+// 后台 goroutine 分割的错误报告给 OnError, OnError 为 nil 时忽略.
 // +dl
 
-// Rotate wrapper RotateWriter, returns io.Writer. invoke RotateWriter.Rotate method by the time.
-func Rotate(w RotateWriter, sets RotateSets) io.Writer {
-	var seconds int64
+// Rotate wrapper RotateWriter, returns io.WriteCloser. invoke RotateWriter.Rotate method by the time.
+// Use RotateErr for the RotateErrWriter, such as file.File.
+func Rotate(w RotateWriter, sets RotateSets) io.WriteCloser {
+	return RotateErr(noErrWriter{w}, sets)
+}
 
-	if w == nil {
-		return nil
-	}
+// +dl zh-cn
+// RotateErr 同 Rotate, 但包装 RotateErrWriter, 比如 file.File.
+// RotateErrWriter.Rotate 返回的错误由触发分割的 Write 返回, 后台 goroutine 分割的错误报告给 OnError.
+// +dl
 
+// RotateErr is Rotate for the RotateErrWriter, such as file.File. The error of Rotate
+// is returned by the Write which triggers the rotation, or reported to OnError
+// if it is triggered by the timer.
+func RotateErr(w RotateErrWriter, sets RotateSets) io.WriteCloser {
 	size, recodes, minutes := sets.Size, sets.Recodes, sets.Minutes
 
 	if size == 0 {
@@ -101,12 +231,20 @@ func Rotate(w RotateWriter, sets RotateSets) io.Writer {
 		minutes = 60 * 24 * 7
 	}
 
-	now := time.Now()
-	if minutes > 0 {
-		seconds = now.Add(time.Duration(int64(minutes) * int64(time.Minute))).Unix()
+	schedule, err := sets.schedule()
+	if err != nil && sets.OnError != nil {
+		sets.OnError(err)
 	}
 
-	return &rotate{w, size, recodes, int64(minutes), 0, 0, seconds, now}
+	now := time.Now()
+	r := &rotate{w: w, maxSize: size, maxRecodes: recodes, minutes: int64(minutes),
+		schedule: schedule, begin: now, onError: sets.OnError}
+	r.next = r.nextTime(now)
+	if sets.Timer {
+		r.done, r.exited = make(chan struct{}), make(chan struct{})
+		go r.run()
+	}
+	return r
 }
 
 // +dl zh-cn
@@ -117,4 +255,32 @@ func Rotate(w RotateWriter, sets RotateSets) io.Writer {
 // RotateSets for Rotate
 type RotateSets struct {
 	Size, Recodes, Minutes int
+
+	Schedule, Location string
+	Weekday            int
+	Timer              bool
+
+	OnError func(error)
+}
+
+// +dl zh-cn
+// Validate 返回 Schedule 或 Location 无效的错误, Rotate 忽略无效的 Schedule.
+// +dl
+
+// Validate returns the error of the invalid Schedule or Location, which is ignored by Rotate.
+func (sets RotateSets) Validate() error {
+	_, err := sets.schedule()
+	return err
+}
+
+// schedule returns the Schedule of sets, nil if Schedule is empty.
+func (sets RotateSets) schedule() (Schedule, error) {
+	if len(sets.Schedule) == 0 {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(sets.Location)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchedule(sets.Schedule, sets.Weekday, loc)
 }
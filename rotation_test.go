@@ -0,0 +1,168 @@
+package log
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	from := time.Date(2014, 2, 18, 17, 30, 27, 0, shanghai) // Tuesday
+	for _, c := range []struct {
+		spec    string
+		weekday int
+		loc     *time.Location
+		want    time.Time
+	}{
+		{"hourly", 0, shanghai, time.Date(2014, 2, 18, 18, 0, 0, 0, shanghai)},
+		{"@daily", 0, shanghai, time.Date(2014, 2, 19, 0, 0, 0, 0, shanghai)},
+		{"daily", 0, time.UTC, time.Date(2014, 2, 19, 0, 0, 0, 0, time.UTC)},
+		{"weekly", 1, shanghai, time.Date(2014, 2, 24, 0, 0, 0, 0, shanghai)},
+		{"weekly", 2, shanghai, time.Date(2014, 2, 25, 0, 0, 0, 0, shanghai)},
+		{"*/20 * * * *", 0, shanghai, time.Date(2014, 2, 18, 17, 40, 0, 0, shanghai)},
+		{"30 2 * * 1-5", 0, shanghai, time.Date(2014, 2, 19, 2, 30, 0, 0, shanghai)},
+		{"0 0 1 3,6 *", 0, shanghai, time.Date(2014, 3, 1, 0, 0, 0, 0, shanghai)},
+		{"0 0 13 * 5", 0, shanghai, time.Date(2014, 2, 21, 0, 0, 0, 0, shanghai)},
+		{"0 0 * * 7", 0, shanghai, time.Date(2014, 2, 23, 0, 0, 0, 0, shanghai)},
+		{"0 0 30 2 *", 0, shanghai, time.Time{}},
+	} {
+		s, err := ParseSchedule(c.spec, c.weekday, c.loc)
+		if err != nil {
+			t.Errorf("%q: %v", c.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(c.want) {
+			t.Errorf("%q: want %v, but got %v", c.spec, c.want, got)
+		}
+	}
+
+	for _, spec := range []string{"", "monthly", "* * * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *"} {
+		if _, err := ParseSchedule(spec, 0, nil); err == nil {
+			t.Errorf("%q: want error", spec)
+		}
+	}
+	if _, err := ParseSchedule("weekly", 7, nil); err == nil {
+		t.Error("want error of weekday")
+	}
+}
+
+type rotateWriter struct {
+	begin, now []time.Time
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w *rotateWriter) Rotate(begin, now time.Time) {
+	w.begin = append(w.begin, begin)
+	w.now = append(w.now, now)
+}
+
+// errRotateWriter returns the error of Rotate.
+type errRotateWriter struct {
+	rotateWriter
+	err error
+}
+
+func (w *errRotateWriter) Rotate(begin, now time.Time) error {
+	w.rotateWriter.Rotate(begin, now)
+	return w.err
+}
+
+func TestRotateSchedule(t *testing.T) {
+	w := &errRotateWriter{}
+	r := RotateErr(w, RotateSets{Schedule: "hourly", Location: "UTC"}).(*rotate)
+	now := time.Now().UTC()
+	want := time.Date(now.Year(), now.Month(), now.Day(), now.Hour()+1, 0, 0, 0, time.UTC)
+	if !r.next.Equal(want) {
+		t.Fatalf("want next %v, but got %v", want, r.next)
+	}
+
+	r.Write([]byte("x"))
+	if len(w.now) != 0 {
+		t.Fatal("rotated before the boundary")
+	}
+
+	// three boundaries passed
+	r.next = want.Add(-3 * time.Hour)
+	r.Write([]byte("x"))
+	if len(w.now) != 1 || !w.now[0].Equal(want.Add(-time.Hour)) || !r.next.Equal(want) {
+		t.Errorf("want rotation at %v, but got %v, next %v", want.Add(-time.Hour), w.now, r.next)
+	}
+
+	w.err = errors.New("rotate")
+	r.next = time.Now()
+	if _, err := r.Write([]byte("x")); err != w.err {
+		t.Errorf("want the error of Rotate, but got %v", err)
+	}
+
+	var reported error
+	RotateErr(w, RotateSets{Schedule: "daily", Location: "Nowhere/Invalid", OnError: func(err error) { reported = err }})
+	if reported == nil {
+		t.Error("the invalid Location is not reported")
+	}
+
+	for _, sets := range []RotateSets{
+		{Schedule: "daily", Location: "Nowhere/Invalid"},
+		{Schedule: "sometimes"},
+	} {
+		if sets.Validate() == nil {
+			t.Errorf("want the error of %+v", sets)
+		}
+	}
+	if err := (RotateSets{Schedule: "weekly", Location: "UTC", Weekday: 1}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+type closeWriter struct {
+	rotateWriter
+	closed bool
+}
+
+func (w *closeWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestRotateTimer(t *testing.T) {
+	w := &closeWriter{}
+	now := time.Now()
+	r := &rotate{w: noErrWriter{w}, minutes: 1, begin: now, next: now.Add(50 * time.Millisecond),
+		done: make(chan struct{}), exited: make(chan struct{})}
+	go r.run()
+
+	time.Sleep(200 * time.Millisecond)
+	if err := r.Close(); err != nil || !w.closed {
+		t.Fatal("Close failed")
+	}
+	if len(w.now) != 1 || w.now[0].Before(now.Add(50*time.Millisecond)) {
+		t.Errorf("want one rotation by the timer, but got %v", w.now)
+	}
+	if r.Close() != nil {
+		t.Error("the second Close failed")
+	}
+
+	// without timer
+	cw := &closeWriter{}
+	if err := Rotate(cw, RotateSets{}).Close(); err != nil || !cw.closed {
+		t.Errorf("want the RotateWriter closed, but got %v %v", cw.closed, err)
+	}
+	// the error of the rotation by the timer is reported
+	errs := make(chan error, 1)
+	ew := &errRotateWriter{err: errors.New("rotate")}
+	r = &rotate{w: ew, minutes: 1, begin: now, next: time.Now().Add(10 * time.Millisecond),
+		onError: func(err error) { errs <- err }, done: make(chan struct{}), exited: make(chan struct{})}
+	go r.run()
+	select {
+	case err := <-errs:
+		if err != ew.err {
+			t.Errorf("want the error of Rotate, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the error of the timer is not reported")
+	}
+	r.Close()
+}
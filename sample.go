@@ -0,0 +1,346 @@
+package log
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// +dl zh-cn
+// SampleSets 是 Sample 的配置参数. 属性值为 0 时采用缺省值:
+//
+//   Interval   1000 毫秒, 采样计数的周期
+//   First      100, 每个周期内每个 级别+消息 最先输出的记录数
+//   Thereafter 之后每 Thereafter 条输出一条, 0 表示全部抑制
+//   Rate       每个级别每秒允许输出的记录数, 0 表示不限制
+//   Burst      令牌桶容量, 缺省为 Rate
+//   Report     10000 毫秒, 报告被抑制记录数的周期
+// +dl
+
+// SampleSets for Sample
+type SampleSets struct {
+	Interval, First, Thereafter, Rate, Burst, Report int
+}
+
+type sampleKey struct {
+	level int
+	msg   string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type sampleState struct {
+	l        Logger // for reporting
+	sets     SampleSets
+	interval time.Duration
+	report   time.Duration
+
+	mu         sync.Mutex
+	start      time.Time // the beginning of the current interval
+	counts     map[sampleKey]int
+	buckets    map[int]*bucket
+	suppressed map[sampleKey]int
+	timer      *time.Timer // pending report
+	closed     bool
+}
+
+type sampler struct {
+	Logger
+	state *sampleState
+}
+
+var _ Logger = &sampler{}
+
+// +dl zh-cn
+/*
+  Sample 包装 Logger l, 返回对重复记录采样和限速的 Logger, 比如防止循环中的 Errorf
+  写满 file.File 或者通过 smtp.Smtp 发送大量邮件.
+  以 级别+消息 为键, Printf 形式的方法以 format 为消息, 每个 Interval 周期内
+  先输出 First 条, 之后每 Thereafter 条输出一条. 通过采样的记录再受每个级别的令牌桶限速.
+  被抑制的记录按键计数, 每个 Report 周期以原级别输出 "suppressed N similar records",
+  字段 "sampled" 为被抑制的消息. Print, Printf 不受影响. Panic, Fatal 被抑制时仍然 panic, 退出.
+  With, WithFields 派生的 Logger 共享计数. Close 先输出未报告的计数, 再关闭 l.
+*/
+// +dl
+
+// Sample returns Logger samples and rate-limits the repeated records of l.
+// The suppressed records are counted and reported periodically.
+func Sample(l Logger, sets SampleSets) Logger {
+	if l == nil {
+		return nil
+	}
+	if sets.Interval <= 0 {
+		sets.Interval = 1000
+	}
+	if sets.First <= 0 {
+		sets.First = 100
+	}
+	if sets.Thereafter < 0 {
+		sets.Thereafter = 0
+	}
+	if sets.Rate < 0 {
+		sets.Rate = 0
+	}
+	if sets.Burst <= 0 {
+		sets.Burst = sets.Rate
+	}
+	if sets.Report <= 0 {
+		sets.Report = 10000
+	}
+	return &sampler{l, &sampleState{
+		l:          l,
+		sets:       sets,
+		interval:   time.Duration(sets.Interval) * time.Millisecond,
+		report:     time.Duration(sets.Report) * time.Millisecond,
+		counts:     map[sampleKey]int{},
+		buckets:    map[int]*bucket{},
+		suppressed: map[sampleKey]int{},
+	}}
+}
+
+// allow reports whether the record of key passes, the suppressed record is counted.
+func (st *sampleState) allow(key sampleKey) bool {
+	now := time.Now()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if now.Sub(st.start) >= st.interval {
+		st.start = now
+		st.counts = map[sampleKey]int{}
+	}
+	n := st.counts[key] + 1
+	st.counts[key] = n
+	ok := n <= st.sets.First ||
+		st.sets.Thereafter != 0 && (n-st.sets.First)%st.sets.Thereafter == 0
+	if ok && st.sets.Rate != 0 {
+		ok = st.take(key.level, now)
+	}
+	if ok {
+		return true
+	}
+
+	st.suppressed[key]++
+	if st.timer == nil && !st.closed {
+		st.timer = time.AfterFunc(st.report, st.flush)
+	}
+	return false
+}
+
+// take takes a token from the bucket of level.
+func (st *sampleState) take(level int, now time.Time) bool {
+	b := st.buckets[level]
+	if b == nil {
+		b = &bucket{tokens: float64(st.sets.Burst), last: now}
+		st.buckets[level] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * float64(st.sets.Rate)
+	if burst := float64(st.sets.Burst); b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// flush reports the suppressed records.
+func (st *sampleState) flush() {
+	st.mu.Lock()
+	suppressed := st.suppressed
+	st.suppressed = map[sampleKey]int{}
+	st.timer = nil
+	st.mu.Unlock()
+
+	for key, n := range suppressed {
+		st.l.With("sampled", key.msg).Output(1,
+			"suppressed "+strconv.Itoa(n)+" similar records", key.level)
+	}
+}
+
+// output writes s if the key of level and msg is allowed.
+func (l *sampler) output(calldepth int, msg, s string, level int, ctx context.Context) {
+	if v, ok := callerLevel(calldepth); ok {
+		if level < v {
+			return
+		}
+	} else if !l.Logger.Enabled(level) {
+		return
+	}
+	if !l.state.allow(sampleKey{level, msg}) {
+		return
+	}
+	lg := l.Logger
+	if ctx != nil {
+		lg = lg.WithFields(contextFields(ctx))
+	}
+	lg.Output(calldepth+1, s, level)
+}
+
+func (l *sampler) Output(calldepth int, s string, optionLevel ...int) error {
+	level := LZero
+	if len(optionLevel) != 0 {
+		level = optionLevel[0]
+	}
+	if level >= LZero {
+		return l.Logger.Output(calldepth+1, s, level)
+	}
+	l.output(calldepth+1, s, s, level, nil)
+	return nil
+}
+
+func (l *sampler) Close() error {
+	st := l.state
+	st.mu.Lock()
+	st.closed = true
+	if st.timer != nil {
+		st.timer.Stop()
+	}
+	st.mu.Unlock()
+	st.flush()
+	return l.Logger.Close()
+}
+
+func (l *sampler) With(kv ...interface{}) Logger {
+	return &sampler{l.Logger.With(kv...), l.state}
+}
+
+func (l *sampler) WithFields(fields Fields) Logger {
+	return &sampler{l.Logger.WithFields(fields), l.state}
+}
+
+func (l *sampler) Debug(v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LDebug, nil)
+}
+
+func (l *sampler) Debugf(format string, v ...interface{}) {
+	l.output(2, format, printf(format, v), LDebug, nil)
+}
+
+func (l *sampler) Info(v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LInfo, nil)
+}
+
+func (l *sampler) Infof(format string, v ...interface{}) {
+	l.output(2, format, printf(format, v), LInfo, nil)
+}
+
+func (l *sampler) Notify(v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LNotify, nil)
+}
+
+func (l *sampler) Notifyf(format string, v ...interface{}) {
+	l.output(2, format, printf(format, v), LNotify, nil)
+}
+
+func (l *sampler) Report(v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LReport, nil)
+}
+
+func (l *sampler) Reportf(format string, v ...interface{}) {
+	l.output(2, format, printf(format, v), LReport, nil)
+}
+
+func (l *sampler) Error(v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LError, nil)
+}
+
+func (l *sampler) Errorf(format string, v ...interface{}) {
+	l.output(2, format, printf(format, v), LError, nil)
+}
+
+func (l *sampler) Alert(v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LAlert, nil)
+}
+
+func (l *sampler) Alertf(format string, v ...interface{}) {
+	l.output(2, format, printf(format, v), LAlert, nil)
+}
+
+func (l *sampler) Panic(v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LPanic, nil)
+	if !l.HasMode(MODE_DONT_PANIC) {
+		panic(v)
+	}
+}
+
+func (l *sampler) Panicf(format string, v ...interface{}) {
+	l.output(2, format, printf(format, v), LPanic, nil)
+	if !l.HasMode(MODE_DONT_PANIC) {
+		panic(v)
+	}
+}
+
+func (l *sampler) Fatal(v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LFatal, nil)
+	if !l.HasMode(MODE_DONT_EXIT) {
+		os.Exit(1)
+	}
+}
+
+func (l *sampler) Fatalf(format string, v ...interface{}) {
+	l.output(2, format, printf(format, v), LFatal, nil)
+	if !l.HasMode(MODE_DONT_EXIT) {
+		os.Exit(1)
+	}
+}
+
+func (l *sampler) DebugContext(ctx context.Context, v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LDebug, ctx)
+}
+
+func (l *sampler) InfoContext(ctx context.Context, v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LInfo, ctx)
+}
+
+func (l *sampler) NotifyContext(ctx context.Context, v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LNotify, ctx)
+}
+
+func (l *sampler) ReportContext(ctx context.Context, v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LReport, ctx)
+}
+
+func (l *sampler) ErrorContext(ctx context.Context, v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LError, ctx)
+}
+
+func (l *sampler) AlertContext(ctx context.Context, v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LAlert, ctx)
+}
+
+func (l *sampler) PanicContext(ctx context.Context, v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LPanic, ctx)
+	if !l.HasMode(MODE_DONT_PANIC) {
+		panic(v)
+	}
+}
+
+func (l *sampler) FatalContext(ctx context.Context, v ...interface{}) {
+	s := printf("", v)
+	l.output(2, s, s, LFatal, ctx)
+	if !l.HasMode(MODE_DONT_EXIT) {
+		os.Exit(1)
+	}
+}
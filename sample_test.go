@@ -0,0 +1,51 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	l := Sample(New(w, "", 0, LDebug), SampleSets{Interval: 60000, First: 2, Thereafter: 3})
+
+	for i := 0; i < 8; i++ {
+		l.Errorf("error %d", i)
+	}
+	// 1, 2, 5, 8
+	want := `[E] "error 0"
+[E] "error 1"
+[E] "error 4"
+[E] "error 7"
+`
+	if got := w.String(); got != want {
+		t.Errorf("want: %#v, but got: %#v", want, got)
+	}
+	w.Reset()
+
+	l.Print("print")
+	l.Print("print")
+	l.With("k", 1).Info("info")
+	if got := strings.Count(w.String(), "\n"); got != 3 {
+		t.Errorf("want 3 records, but got: %#v", w.String())
+	}
+	w.Reset()
+
+	l.Close()
+	check(t, w, `[E] "suppressed 4 similar records" sampled="error %d"`)
+}
+
+func TestSampleRate(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	l := Sample(New(w, "", 0, LDebug), SampleSets{Rate: 1, Burst: 2, Report: 60000})
+	defer l.Close()
+
+	for i := 0; i < 5; i++ {
+		l.Infof("info %d", i)
+		l.Debug("debug")
+	}
+	if got := strings.Count(w.String(), "\n"); got != 4 {
+		t.Errorf("want 4 records, but got: %#v", w.String())
+	}
+}
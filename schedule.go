@@ -0,0 +1,152 @@
+package log
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// +dl zh-cn
+/*
+  Schedule 是日历对齐的分割时间表, Next 返回 t 之后的第一个分割时间.
+*/
+// +dl
+
+// Schedule is the calendar-aligned rotation times, Next returns the first time after t.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// +dl zh-cn
+/*
+  ParseSchedule 解析 spec, 返回在时区 loc 中对齐的 Schedule, loc 为 nil 表示 time.Local.
+  spec 可以是:
+
+	hourly     每小时整点
+	daily      每天 00:00
+	weekly     每周 weekday 的 00:00, weekday 为 time.Weekday, 0 表示星期日
+	cron 表达式 "分 时 日 月 周", 支持 *, 列表 1,2, 范围 1-5 和步长 0-59/10.
+	           日和周都被限定时, 满足其一即可. 比如 "30 2 * * 1-5".
+
+  hourly, daily, weekly 可以带 "@" 前缀.
+*/
+// +dl
+
+// ParseSchedule returns the Schedule of spec in loc, spec is one of
+// "hourly", "daily", "weekly" or the 5 fields cron expression.
+func ParseSchedule(spec string, weekday int, loc *time.Location) (Schedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	switch strings.ToLower(strings.TrimPrefix(strings.TrimSpace(spec), "@")) {
+	case "hourly":
+		return &cron{minute: 1, hour: all, dom: all, month: all, dow: all, loc: loc}, nil
+	case "daily":
+		return &cron{minute: 1, hour: 1, dom: all, month: all, dow: all, loc: loc}, nil
+	case "weekly":
+		if weekday < 0 || weekday > 6 {
+			return nil, errors.New("log: invalid weekday " + strconv.Itoa(weekday))
+		}
+		return &cron{minute: 1, hour: 1, dom: all, month: all, dow: 1 << uint(weekday), loc: loc, domStar: true}, nil
+	}
+	return parseCron(spec, loc)
+}
+
+const all = ^uint64(0)
+
+// cron is the bit sets of the matched values.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+	loc                           *time.Location
+}
+
+var cronRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+func parseCron(spec string, loc *time.Location) (*cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New("log: invalid schedule " + spec)
+	}
+	var bits [5]uint64
+	for i, field := range fields {
+		for _, part := range strings.Split(field, ",") {
+			b, err := parseCronPart(part, cronRanges[i][0], cronRanges[i][1])
+			if err != nil {
+				return nil, errors.New("log: invalid schedule " + spec)
+			}
+			bits[i] |= b
+		}
+	}
+	// 7 is Sunday too
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cron{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domStar: fields[2] == "*", dowStar: fields[4] == "*", loc: loc,
+	}, nil
+}
+
+// parseCronPart parses "*", "n", "n-m" with optional "/step".
+func parseCronPart(part string, min, max int) (bits uint64, err error) {
+	step := 1
+	if i := strings.IndexByte(part, '/'); i != -1 {
+		if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+			return 0, ErrSyntax
+		}
+		part = part[:i]
+	}
+	lo, hi := min, max
+	if part != "*" {
+		i := strings.IndexByte(part, '-')
+		if i == -1 {
+			lo, err = strconv.Atoi(part)
+			hi = lo
+			if step != 1 {
+				hi = max
+			}
+		} else if lo, err = strconv.Atoi(part[:i]); err == nil {
+			hi, err = strconv.Atoi(part[i+1:])
+		}
+		if err != nil || lo < min || hi > max || lo > hi {
+			return 0, ErrSyntax
+		}
+	}
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+	return
+}
+
+func (c *cron) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first matched minute after t, or zero time if none in 5 years.
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.In(c.loc)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, c.loc)
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,260 @@
+package log
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// +dl zh-cn
+/*
+  SlogLevel 把 log/slog 的级别映射到 LDebug...LFatal:
+
+	       < Info   LDebug
+	Info   ... +1   LInfo
+	Info+2 ... +3   LNotify
+	Warn   ... +7   LReport
+	Error  ... +3   LError
+	Error+4 ... +7  LAlert
+	Error+8 ... +11 LPanic
+	       >= +12   LFatal
+*/
+// +dl
+
+// SlogLevel maps the slog level to the range LDebug...LFatal.
+func SlogLevel(level slog.Level) int {
+	switch {
+	case level < slog.LevelInfo:
+		return LDebug
+	case level < slog.LevelInfo+2:
+		return LInfo
+	case level < slog.LevelWarn:
+		return LNotify
+	case level < slog.LevelError:
+		return LReport
+	case level < slog.LevelError+4:
+		return LError
+	case level < slog.LevelError+8:
+		return LAlert
+	case level < slog.LevelError+12:
+		return LPanic
+	}
+	return LFatal
+}
+
+// +dl zh-cn
+// LevelSlog 是 SlogLevel 的逆映射, LZero 被映射为 slog.LevelInfo.
+// +dl
+
+// LevelSlog maps the level to the slog level, it is the reverse of SlogLevel.
+func LevelSlog(level int) slog.Level {
+	switch level {
+	case LDebug:
+		return slog.LevelDebug
+	case LNotify:
+		return slog.LevelInfo + 2
+	case LReport:
+		return slog.LevelWarn
+	case LError:
+		return slog.LevelError
+	case LAlert:
+		return slog.LevelError + 4
+	case LPanic:
+		return slog.LevelError + 8
+	case LFatal:
+		return slog.LevelError + 12
+	}
+	return slog.LevelInfo
+}
+
+// +dl zh-cn
+/*
+  NewSlogHandler 返回以 Logger l 为后端的 slog.Handler.
+  Enabled 遵循 l 的级别设置, attrs 成为 Fields, group 以 "group.key" 的形式展开.
+*/
+// +dl
+
+// NewSlogHandler returns a slog.Handler writes to l.
+func NewSlogHandler(l Logger) slog.Handler {
+	if l == nil {
+		return nil
+	}
+	return &slogHandler{l: l}
+}
+
+type slogHandler struct {
+	l      Logger
+	fields Fields
+	group  string // with the trailing dot
+}
+
+func (h *slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.l.Enabled(SlogLevel(level))
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := h.fields
+	if r.NumAttrs() != 0 {
+		fields = append(make(Fields, 0, len(fields)+r.NumAttrs()), fields...)
+		r.Attrs(func(a slog.Attr) bool {
+			fields = appendAttr(fields, h.group, a)
+			return true
+		})
+	}
+	level := SlogLevel(r.Level)
+
+	lg, ok := h.l.(*logger)
+	if !ok {
+		// user, slog.Logger.Info, slog.Logger.log, Handle, Output
+		return h.l.WithFields(fields).Output(4, r.Message, level)
+	}
+	if v, ok := vmoduleLevel(r.PC); ok {
+		if level < v {
+			return nil
+		}
+	} else if !lg.Enabled(level) {
+		return nil
+	}
+
+	rec := Record{
+		Time: r.Time, Level: level, Message: r.Message,
+		Fields: joinFields(lg.fields, fields), PC: r.PC, ctx: ctx,
+	}
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		rec.File, rec.Line = frame.File, frame.Line
+	} else if lg.getFlag()&(Lshortfile|Llongfile) != 0 {
+		rec.File = "???"
+	}
+	if ctx != nil {
+		rec.Fields = joinFields(rec.Fields, contextFields(ctx))
+	}
+	return lg.write(rec)
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	fields := append(make(Fields, 0, len(h.fields)+len(attrs)), h.fields...)
+	for _, a := range attrs {
+		fields = appendAttr(fields, h.group, a)
+	}
+	return &slogHandler{h.l, fields, h.group}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+	return &slogHandler{h.l, h.fields, h.group + name + "."}
+}
+
+// appendAttr appends a as Field, the attrs of group are flattened.
+func appendAttr(fields Fields, group string, a slog.Attr) Fields {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		attrs := v.Group()
+		if len(attrs) == 0 {
+			return fields
+		}
+		if len(a.Key) != 0 {
+			group = group + a.Key + "."
+		}
+		for _, sub := range attrs {
+			fields = appendAttr(fields, group, sub)
+		}
+		return fields
+	}
+	if len(a.Key) == 0 && v.Kind() == slog.KindAny && v.Any() == nil {
+		return fields
+	}
+	return append(fields, Field{group + a.Key, slogValue(v)})
+}
+
+func slogValue(v slog.Value) interface{} {
+	switch v.Kind() {
+	case slog.KindString:
+		return v.String()
+	case slog.KindInt64:
+		return v.Int64()
+	case slog.KindUint64:
+		return v.Uint64()
+	case slog.KindFloat64:
+		return v.Float64()
+	case slog.KindBool:
+		return v.Bool()
+	case slog.KindDuration:
+		return v.Duration()
+	case slog.KindTime:
+		return v.Time()
+	}
+	return v.Any()
+}
+
+// +dl zh-cn
+/*
+  NewSlog 返回输出到 slog.Handler h 的 Logger, 参数 prefix, flags 与 New 相同.
+  Logger 的级别由 LevelSlog 映射后交给 h, 并且遵循 h.Enabled.
+  Fields 成为 attrs, 非空的 prefix 成为 "prefix" attr, 通过 Write 写入的数据作为 LInfo 级别的消息.
+*/
+// +dl
+
+// NewSlog returns Logger writes to the slog.Handler h.
+func NewSlog(h slog.Handler, prefix string, flags ...int) Logger {
+	if h == nil {
+		return nil
+	}
+	return New(&slogWriter{h}, prefix, flags...)
+}
+
+type slogWriter struct {
+	h slog.Handler
+}
+
+var _ RecordWriter = &slogWriter{}
+
+func (w *slogWriter) WriteRecord(r *Record) error {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	level := LevelSlog(r.Level)
+	if r.Level != LZero && !w.h.Enabled(ctx, level) {
+		return nil
+	}
+
+	rec := slog.NewRecord(r.Time, level, r.Message, r.PC)
+	if len(r.Prefix) != 0 {
+		rec.AddAttrs(slog.String("prefix", r.Prefix))
+	}
+	for _, f := range r.Fields {
+		rec.AddAttrs(slog.Any(f.Key, f.Value))
+	}
+	return w.h.Handle(ctx, rec)
+}
+
+func (w *slogWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	var pcs [1]uintptr
+	// runtime.Callers, Write, logger.Write, user
+	runtime.Callers(3, pcs[:])
+	ctx := context.Background()
+	rec := slog.NewRecord(time.Now(), slog.LevelInfo, strings.TrimRight(string(p), "\r\n"), pcs[0])
+	if w.h.Enabled(ctx, slog.LevelInfo) {
+		return len(p), w.h.Handle(ctx, rec)
+	}
+	return len(p), nil
+}
+
+func (w *slogWriter) Close() error {
+	if c, ok := w.h.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	l := New(w, "slog", Lshortfile, LNotify)
+	s := slog.New(NewSlogHandler(l))
+
+	s.Info("info")
+	check(t, w, "")
+
+	s.With("a", 1).WithGroup("g").Warn("warn", "b", "x", slog.Group("h", "c", true))
+	check(t, w, `slog [R] <slog_test.go:18> "warn" a=1 g.b="x" g.h.c=true`)
+
+	s.Log(context.Background(), slog.LevelError+12, "fatal")
+	check(t, w, `slog [F] <slog_test.go:21> "fatal"`)
+}
+
+func TestNewSlog(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	h := slog.NewTextHandler(w, &slog.HandlerOptions{
+		AddSource: true,
+		Level:     slog.LevelWarn,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			if a.Key == slog.SourceKey {
+				src := a.Value.Any().(*slog.Source)
+				return slog.Int("line", src.Line)
+			}
+			return a
+		},
+	})
+	l := NewSlog(h, "p", 0).With("k", "v")
+
+	l.Info("info")
+	check(t, w, "")
+
+	l.Errorf("%d", 1)
+	check(t, w, `level=ERROR line=46 msg=1 prefix=p k=v`)
+
+	l.Output(1, "always")
+	check(t, w, `level=INFO line=49 msg=always prefix=p k=v`)
+
+	if l.Close() != nil {
+		t.Error("Close failed")
+	}
+}
@@ -0,0 +1,260 @@
+package smtp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLS modes of Sets.TLS.
+const (
+	TLS_AUTO     = iota // STARTTLS if the server supports, default
+	TLS_STARTTLS        // STARTTLS is required
+	TLS_IMPLICIT        // TLS from the beginning, e.g. port 465
+	TLS_NONE            // plain text
+)
+
+// Auth mechanisms of Sets.Auth.
+const (
+	AUTH_PLAIN   = "plain"
+	AUTH_LOGIN   = "login"
+	AUTH_CRAMMD5 = "cram-md5"
+	AUTH_NONE    = "none"
+)
+
+// loginAuth implements the LOGIN mechanism.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("smtp: unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("smtp: wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	prompt := strings.ToLower(strings.TrimSpace(string(fromServer)))
+	switch {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	}
+	return nil, errors.New("smtp: unexpected LOGIN challenge " + string(fromServer))
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+// newAuth returns the smtp.Auth of arg.Auth, nil for none.
+func newAuth(arg Sets, host string) (smtp.Auth, error) {
+	username := address(arg.Username)
+	switch strings.ToLower(arg.Auth) {
+	case "":
+		if len(arg.Password) == 0 {
+			return nil, nil
+		}
+		fallthrough
+	case AUTH_PLAIN:
+		return smtp.PlainAuth(arg.Identity, username, arg.Password, host), nil
+	case AUTH_LOGIN:
+		return &loginAuth{username, arg.Password, host}, nil
+	case AUTH_CRAMMD5:
+		return smtp.CRAMMD5Auth(username, arg.Password), nil
+	case AUTH_NONE:
+		return nil, nil
+	}
+	return nil, errors.New("smtp: unknown auth mechanism " + arg.Auth)
+}
+
+// newTLSConfig returns the tls.Config of arg, the files are added to a clone of arg.TLSConfig.
+func newTLSConfig(arg Sets, host string) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if arg.TLSConfig != nil {
+		cfg = arg.TLSConfig.Clone()
+	}
+	if len(cfg.ServerName) == 0 {
+		cfg.ServerName = host
+	}
+	if len(arg.CAFile) != 0 {
+		pem, err := os.ReadFile(arg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.RootCAs == nil {
+			cfg.RootCAs = x509.NewCertPool()
+		}
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("smtp: no certificate in " + arg.CAFile)
+		}
+	}
+	if len(arg.CertFile) != 0 || len(arg.KeyFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(arg.CertFile, arg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+	return cfg, nil
+}
+
+// dial connects to the server, starts TLS and authenticates by arg.
+func (s *Smtp) dial() (*smtp.Client, net.Conn, error) {
+	host, addr := s.arg.Host, s.arg.Host
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	} else if s.arg.TLS == TLS_IMPLICIT {
+		addr = net.JoinHostPort(addr, "465")
+	} else {
+		addr = net.JoinHostPort(addr, "25")
+	}
+
+	d := &net.Dialer{Timeout: s.arg.dialTimeout()}
+	var conn net.Conn
+	var err error
+	if s.arg.TLS == TLS_IMPLICIT {
+		conn, err = tls.DialWithDialer(d, "tcp", addr, s.tls)
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(s.arg.timeout()))
+
+	c, err := smtp.NewClient(conn, host)
+	if err == nil && s.arg.TLS != TLS_IMPLICIT && s.arg.TLS != TLS_NONE {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			err = c.StartTLS(s.tls)
+		} else if s.arg.TLS == TLS_STARTTLS {
+			err = errors.New("smtp: server doesn't support STARTTLS")
+		}
+	}
+	if err == nil && s.auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			err = c.Auth(s.auth)
+		} else {
+			err = errors.New("smtp: server doesn't support AUTH")
+		}
+	}
+	if err != nil {
+		if c != nil {
+			c.Close()
+		} else {
+			conn.Close()
+		}
+		return nil, nil, err
+	}
+	return c, conn, nil
+}
+
+// send delivers msg, the connection is reused until it is idle for Sets.Idle.
+func (s *Smtp) send(msg []byte) (err error) {
+	if s.setup != nil {
+		return s.setup
+	}
+
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+
+	if s.client != nil {
+		s.conn.SetDeadline(time.Now().Add(s.arg.timeout()))
+		if s.client.Reset() != nil {
+			s.closeClient(false)
+		}
+	}
+	if s.client == nil {
+		if s.client, s.conn, err = s.dial(); err != nil {
+			return
+		}
+	}
+
+	if err = s.transfer(msg); err != nil {
+		s.closeClient(false)
+		return
+	}
+
+	if s.arg.Idle < 0 {
+		s.closeClient(true)
+	} else if s.idle == nil {
+		s.idle = time.AfterFunc(s.arg.idle(), s.expire)
+	} else {
+		s.idle.Reset(s.arg.idle())
+	}
+	return
+}
+
+func (s *Smtp) transfer(msg []byte) error {
+	s.conn.SetDeadline(time.Now().Add(s.arg.timeout()))
+	if err := s.client.Mail(address(s.arg.Username)); err != nil {
+		return err
+	}
+	for _, rcpt := range s.recipients() {
+		if err := s.client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := s.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *Smtp) expire() {
+	s.cmu.Lock()
+	s.closeClient(true)
+	s.cmu.Unlock()
+}
+
+// closeClient closes the connection, sends QUIT if quit is true. s.cmu must be locked.
+func (s *Smtp) closeClient(quit bool) {
+	if s.client == nil {
+		return
+	}
+	if quit {
+		s.conn.SetDeadline(time.Now().Add(s.arg.timeout()))
+		s.client.Quit()
+	}
+	s.client.Close()
+	s.client, s.conn = nil, nil
+}
+
+func (arg Sets) dialTimeout() time.Duration {
+	if arg.DialTimeout > 0 {
+		return time.Duration(arg.DialTimeout) * time.Millisecond
+	}
+	return 10 * time.Second
+}
+
+func (arg Sets) timeout() time.Duration {
+	if arg.Timeout > 0 {
+		return time.Duration(arg.Timeout) * time.Millisecond
+	}
+	return 30 * time.Second
+}
+
+func (arg Sets) idle() time.Duration {
+	if arg.Idle > 0 {
+		return time.Duration(arg.Idle) * time.Millisecond
+	}
+	return 30 * time.Second
+}
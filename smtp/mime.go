@@ -0,0 +1,167 @@
+package smtp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/typepress/log"
+)
+
+// Summary is the data of the subject template.
+type Summary struct {
+	Level string // the name of the most severe level in the batch, e.g. "alert"
+	Host  string // the host name
+	Count int    // the number of records
+}
+
+var table = template.Must(template.New("table").Parse(`<table border="1" cellspacing="0" cellpadding="4">
+<tr><th>Time</th><th>Level</th><th>Prefix</th><th>Caller</th><th>Message</th><th>Fields</th><th>Count</th></tr>
+{{range .}}<tr>{{if .Rec}}<td>{{.Time}}</td><td>{{.Level}}</td><td>{{.Rec.Prefix}}</td><td>{{.Rec.Caller}}</td><td>{{.Rec.Message}}</td><td>{{.Fields}}</td>{{else}}<td colspan="6">{{.Line}}</td>{{end}}<td>{{.Count}}</td></tr>
+{{end}}</table>
+`))
+
+// row is the data of a table row.
+type row struct {
+	Rec    *log.Record
+	Line   string
+	Time   string
+	Level  string
+	Fields string
+	Count  int
+}
+
+// message returns the MIME message of the batch.
+func (s *Smtp) message(subject string, entries []*entry, lines []string) []byte {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		if len(value) != 0 {
+			buf.WriteString(key + ": " + value + "\r\n")
+		}
+	}
+	header("From", addressList([]string{s.arg.Username}))
+	header("To", addressList(s.arg.To))
+	header("Cc", addressList(s.arg.Cc))
+	header("Subject", mime.QEncoding.Encode("UTF-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", s.messageID())
+	header("MIME-Version", "1.0")
+
+	mixed := multipart.NewWriter(&buf)
+	alt := mixed
+	if len(s.arg.Attachment) != 0 {
+		header("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+		buf.WriteString("\r\n")
+		boundary := multipart.NewWriter(nil).Boundary()
+		w, _ := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"multipart/alternative; boundary=" + boundary},
+		})
+		alt = newWriter(w, boundary)
+	} else {
+		header("Content-Type", "multipart/alternative; boundary="+mixed.Boundary())
+		buf.WriteString("\r\n")
+	}
+
+	writeText(alt, "text/plain; charset=UTF-8", digest(entries))
+	var html bytes.Buffer
+	table.Execute(&html, rows(entries))
+	writeText(alt, "text/html; charset=UTF-8", html.Bytes())
+
+	if alt != mixed {
+		alt.Close()
+		w, _ := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType("text/plain", map[string]string{"charset": "UTF-8", "name": s.arg.Attachment})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": s.arg.Attachment})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		writeBase64(w, []byte(strings.Join(lines, "\n")+"\n"))
+	}
+	mixed.Close()
+	return buf.Bytes()
+}
+
+// newWriter returns multipart.Writer writes to w with boundary.
+func newWriter(w io.Writer, boundary string) *multipart.Writer {
+	mw := multipart.NewWriter(w)
+	mw.SetBoundary(boundary)
+	return mw
+}
+
+func writeText(mw *multipart.Writer, contentType string, text []byte) {
+	w, _ := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	qw := quotedprintable.NewWriter(w)
+	qw.Write(text)
+	qw.Close()
+}
+
+// writeBase64 writes p in base64 with 76 characters per line.
+func writeBase64(w io.Writer, p []byte) {
+	enc := base64.StdEncoding.EncodeToString(p)
+	for len(enc) > 76 {
+		io.WriteString(w, enc[:76]+"\r\n")
+		enc = enc[76:]
+	}
+	io.WriteString(w, enc+"\r\n")
+}
+
+func rows(entries []*entry) []row {
+	rs := make([]row, len(entries))
+	for i, e := range entries {
+		rs[i] = row{Rec: e.rec, Line: e.line, Count: e.count}
+		if r := e.rec; r != nil {
+			if r.Flags&(log.Ldate|log.Ltime|log.Lmicroseconds) != 0 {
+				rs[i].Time = r.Time.Format("2006-01-02 15:04:05.000000")
+			}
+			rs[i].Level = log.LevelName(r.Level)
+			var fields []string
+			for _, f := range r.Fields {
+				fields = append(fields, fmt.Sprintf("%s=%v", f.Key, f.Value))
+			}
+			rs[i].Fields = strings.Join(fields, " ")
+		}
+	}
+	return rs
+}
+
+// addressList returns the header value of addresses, the display names are encoded.
+func addressList(addrs []string) string {
+	list := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		if len(a) == 0 {
+			continue
+		}
+		if addr, err := mail.ParseAddress(a); err == nil {
+			a = addr.String()
+		}
+		list = append(list, a)
+	}
+	return strings.Join(list, ", ")
+}
+
+// address returns the email address of a, e.g. "b@c" for "a <b@c>".
+func address(a string) string {
+	if addr, err := mail.ParseAddress(a); err == nil {
+		return addr.Address
+	}
+	return a
+}
+
+func (s *Smtp) messageID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b[:]), s.host)
+}
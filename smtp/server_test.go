@@ -0,0 +1,359 @@
+package smtp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/typepress/log"
+)
+
+// fakeServer is an in-process SMTP server for tests.
+type fakeServer struct {
+	t        *testing.T
+	ln       net.Listener
+	tls      *tls.Config // enables STARTTLS if not nil
+	user     string
+	password string
+
+	mu    sync.Mutex
+	conns int
+	auths []string // the mechanisms of successful AUTH
+	mails []fakeMail
+}
+
+type fakeMail struct {
+	from string
+	rcpt []string
+	data string
+}
+
+func newFakeServer(t *testing.T, implicit bool, cfg *tls.Config) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &fakeServer{t: t, ln: ln, tls: cfg, user: "log@example.com", password: "secret"}
+	if implicit {
+		srv.ln, srv.tls = tls.NewListener(ln, cfg), nil
+	}
+	go func() {
+		for {
+			conn, err := srv.ln.Accept()
+			if err != nil {
+				return
+			}
+			srv.mu.Lock()
+			srv.conns++
+			srv.mu.Unlock()
+			go srv.serve(conn)
+		}
+	}()
+	return srv
+}
+
+func (srv *fakeServer) Addr() string {
+	return srv.ln.Addr().String()
+}
+
+func (srv *fakeServer) Close() {
+	srv.ln.Close()
+}
+
+func (srv *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+
+	var mail fakeMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i != -1 {
+			cmd, arg = line[:i], line[i+1:]
+		}
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			tp.PrintfLine("250-fake")
+			if srv.tls != nil {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN LOGIN CRAM-MD5")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			conn = tls.Server(conn, srv.tls)
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			srv.auth(tp, arg)
+		case "MAIL":
+			mail = fakeMail{from: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")}
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			mail.rcpt = append(mail.rcpt, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			mail.data = string(data)
+			srv.mu.Lock()
+			srv.mails = append(srv.mails, mail)
+			srv.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "RSET", "NOOP":
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func (srv *fakeServer) auth(tp *textproto.Conn, arg string) {
+	fields := strings.Fields(arg)
+	mech := strings.ToUpper(fields[0])
+	ok := false
+	switch mech {
+	case "PLAIN":
+		resp, _ := base64.StdEncoding.DecodeString(fields[1])
+		ok = string(resp) == "\x00"+srv.user+"\x00"+srv.password
+	case "LOGIN":
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+		user := readBase64(tp)
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+		ok = user == srv.user && readBase64(tp) == srv.password
+	case "CRAM-MD5":
+		challenge := "<1.2@fake>"
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+		d := hmac.New(md5.New, []byte(srv.password))
+		d.Write([]byte(challenge))
+		ok = readBase64(tp) == srv.user+" "+hex.EncodeToString(d.Sum(nil))
+	}
+	if !ok {
+		tp.PrintfLine("535 authentication failed")
+		return
+	}
+	srv.mu.Lock()
+	srv.auths = append(srv.auths, mech)
+	srv.mu.Unlock()
+	tp.PrintfLine("235 ok")
+}
+
+func readBase64(tp *textproto.Conn) string {
+	line, _ := tp.ReadLine()
+	b, _ := base64.StdEncoding.DecodeString(line)
+	return string(b)
+}
+
+// selfSigned returns the server and client tls.Config of a certificate for 127.0.0.1.
+func selfSigned(t *testing.T) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client = &tls.Config{RootCAs: pool}
+	return
+}
+
+func TestTransport(t *testing.T) {
+	serverTLS, clientTLS := selfSigned(t)
+	for _, c := range []struct {
+		name     string
+		implicit bool
+		tls      *tls.Config
+		sets     Sets
+		auth     string
+	}{
+		{"plain", false, nil, Sets{}, "PLAIN"},
+		{"login", false, nil, Sets{Auth: AUTH_LOGIN}, "LOGIN"},
+		{"cram-md5", false, nil, Sets{Auth: AUTH_CRAMMD5}, "CRAM-MD5"},
+		{"none", false, nil, Sets{Auth: AUTH_NONE}, ""},
+		{"starttls", false, serverTLS, Sets{TLS: TLS_STARTTLS, TLSConfig: clientTLS}, "PLAIN"},
+		{"implicit", true, serverTLS, Sets{TLS: TLS_IMPLICIT, TLSConfig: clientTLS}, "PLAIN"},
+	} {
+		srv := newFakeServer(t, c.implicit, c.tls)
+		sets := c.sets
+		sets.Host = srv.Addr()
+		sets.Username = "log <log@example.com>"
+		sets.Password = "secret"
+		sets.To = []string{"a@example.com"}
+		sets.Bcc = []string{"b@example.com"}
+		sets.Subject = "test"
+		sets.Count = 1
+		s := New(sets)
+
+		for i := 0; i < 3; i++ {
+			if _, err := s.Write([]byte("[A] \"alert\"\n")); err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		srv.Close()
+
+		srv.mu.Lock()
+		if srv.conns != 1 {
+			t.Errorf("%s: want 1 connection, but got %d", c.name, srv.conns)
+		}
+		if len(srv.mails) != 3 || srv.mails[0].from != "log@example.com" ||
+			strings.Join(srv.mails[0].rcpt, ",") != "a@example.com,b@example.com" ||
+			!strings.Contains(srv.mails[2].data, "Subject: test") {
+			t.Errorf("%s: unexpected mails %v", c.name, srv.mails)
+		}
+		if c.auth == "" && len(srv.auths) != 0 || c.auth != "" && (len(srv.auths) != 1 || srv.auths[0] != c.auth) {
+			t.Errorf("%s: want auth %q, but got %q", c.name, c.auth, srv.auths)
+		}
+		srv.mu.Unlock()
+	}
+}
+
+func TestTransportErrors(t *testing.T) {
+	srv := newFakeServer(t, false, nil)
+	defer srv.Close()
+
+	for _, c := range []struct {
+		name string
+		sets Sets
+	}{
+		{"wrong password", Sets{Host: srv.Addr(), Username: "log@example.com", Password: "wrong"}},
+		{"missing STARTTLS", Sets{Host: srv.Addr(), TLS: TLS_STARTTLS, Auth: AUTH_NONE}},
+		{"unknown auth", Sets{Host: srv.Addr(), Auth: "unknown"}},
+		{"dial", Sets{Host: "127.0.0.1:1", Auth: AUTH_NONE, DialTimeout: 100}},
+	} {
+		sets := c.sets
+		sets.To, sets.Count, sets.Retries = []string{"a@example.com"}, 1, -1
+		s := New(sets)
+		if _, err := s.Write([]byte("x\n")); err != nil {
+			t.Errorf("%s: Write returns the delivery error %v", c.name, err)
+		}
+		if err := s.Flush(); err == nil {
+			t.Errorf("%s: want error", c.name)
+		}
+		if s.Close() != nil || s.Stats().Failed != 1 {
+			t.Errorf("%s: unexpected stats %+v", c.name, s.Stats())
+		}
+	}
+}
+
+func TestRetrySpool(t *testing.T) {
+	dir := t.TempDir()
+	var failures []error
+	fail := 4
+	s := New(Sets{Count: 1, Retries: 2, Backoff: 1, Spool: dir, OnFailure: func(err error, msg []byte) {
+		failures = append(failures, err)
+	}})
+	var sent []string
+	s.deliver = func(msg []byte) error {
+		if fail > 0 {
+			fail--
+			return errors.New("relay down")
+		}
+		sent = append(sent, parseMessage(t, msg).text)
+		return nil
+	}
+
+	s.Write([]byte("first\n")) // fails 3 times, spooled
+	if err := s.Flush(); err == nil || len(failures) != 1 {
+		t.Fatal("want delivery failure")
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, "*.eml")); len(names) != 1 {
+		t.Fatalf("want 1 spooled message, but got %v", names)
+	}
+
+	s.Write([]byte("second\n")) // fails once, retried, then the spool is re-sent
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(sent, "") != "second\nfirst\n" {
+		t.Errorf("unexpected sent %q", sent)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, "*")); len(names) != 0 {
+		t.Errorf("the spool is not cleaned %v", names)
+	}
+	want := Stats{Sent: 2, Retried: 3, Failed: 1, Spooled: 1, Resent: 1}
+	if got := s.Stats(); got != want {
+		t.Errorf("want %+v, but got %+v", want, got)
+	}
+	if _, err := s.Write([]byte("x\n")); err != log.ErrClosed {
+		t.Errorf("want ErrClosed, but got %v", err)
+	}
+}
+
+func TestDeadRelay(t *testing.T) {
+	for _, spool := range []string{"", t.TempDir()} {
+		release := make(chan struct{})
+		s := New(Sets{Count: 1, Retries: -1, Spool: spool})
+		s.deliver = func(msg []byte) error {
+			<-release // the relay does not respond
+			return nil
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				s.Write([]byte("record\n"))
+			}
+			s.Rotate(time.Now(), time.Now())
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("spool %q: Write blocks on the dead relay", spool)
+		}
+		close(release)
+		s.Close()
+
+		got := s.Stats()
+		lost := got.Dropped
+		if len(spool) != 0 {
+			lost = got.Spooled
+		}
+		if lost == 0 || got.Sent+lost < 100 || len(spool) != 0 && got.Dropped != 0 {
+			t.Errorf("spool %q: unexpected stats %+v", spool, got)
+		}
+	}
+}
@@ -1,12 +1,56 @@
 package smtp
 
 import (
+	"bytes"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/smtp"
+	"os"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
+
+	"github.com/typepress/log"
 )
 
+// Sets for New.
+//
+// Window and Count are the flush conditions of the batch, Window is in milliseconds.
+// When the value is 0, the default is used:
+//
+//	Window 60000
+//	Count  100
+//
+// When the value is less than 0, the condition is ignored,
+// the batch is sent by Rotate and Close only.
+//
+// Subject is a text/template executed with Summary, e.g. "[{{.Level}}] {{.Host}} ({{.Count}} records)",
+// the Subject without "{{" is used as is. The error of the template is returned by every send,
+// see Flush and OnFailure.
+// Bcc receives the email without appearing in the headers.
+// If Attachment is not empty, all records of the batch are attached as the file of that name.
+//
+// TLS is one of the TLS_* modes, TLSConfig, CAFile, CertFile and KeyFile configure the TLS.
+// Auth is one of the AUTH_* mechanisms, it defaults to AUTH_PLAIN if Password is not empty.
+// The timeouts are in milliseconds, the defaults are:
+//
+//	DialTimeout 10000
+//	Timeout     30000, the deadline of each send
+//	Idle        30000, the connection is reused until it is idle for Idle, < 0 means no reuse
+//
+// The digest is sent by a background goroutine, the failed delivery is retried
+// with exponential backoff from Backoff to MaxBackoff milliseconds. The defaults are:
+//
+//	Retries    3, < 0 means no retry
+//	Backoff    1000
+//	MaxBackoff 60000
+//
+// If Spool is not empty, the message failed after retries is saved to the Spool directory,
+// and re-sent after the next successful delivery. OnFailure is called for each failed message.
+// Write and Rotate never wait for the delivery, if the queue is full the message
+// is saved to the Spool directory too, or dropped if Spool is empty, see Stats.
 type Sets struct {
 	Identity string
 	Username string
@@ -14,43 +58,309 @@ type Sets struct {
 	Host     string
 	Subject  string
 	To       []string
+	Cc       []string
+	Bcc      []string
+
+	Attachment string
+
+	Window, Count int
+
+	TLS                       int
+	TLSConfig                 *tls.Config
+	CAFile, CertFile, KeyFile string
+	Auth                      string
+
+	DialTimeout, Timeout, Idle int
+
+	Retries, Backoff, MaxBackoff int
+	Spool                        string
+	OnFailure                    func(err error, msg []byte)
+}
+
+// entry is the merged identical records.
+type entry struct {
+	key         string
+	line        string // the first record
+	count       int
+	first, last time.Time
+	rec         *log.Record // nil if the record is not parsed
 }
 
+// Smtp is the batching sender, collects records then sends one digest email.
 type Smtp struct {
-	arg  Sets
-	auth smtp.Auth
+	arg     Sets
+	auth    smtp.Auth
+	tls     *tls.Config
+	setup   error // the error of New, returned by every send
+	subject *template.Template
+	host    string
+	deliver func(msg []byte) error
+
+	mu      sync.Mutex
+	entries []*entry
+	lines   []string // all records for the attachment
+	index   map[string]*entry
+	records int
+	timer   *time.Timer
+
+	queue  chan item
+	done   chan struct{}
+	exited chan struct{}
+	once   sync.Once
+	err    error // first error since last Flush, used by the sender goroutine only
+	stats  Stats
+	queued sync.WaitGroup // the batches flushed but not queued yet
+
+	cmu    sync.Mutex // protects the connection
+	client *smtp.Client
+	conn   net.Conn
+	idle   *time.Timer
 }
 
 func New(arg Sets) *Smtp {
 	arg.To = append([]string{}, arg.To...)
-	names := strings.Split(arg.Username, `<`)
-	if len(names) == 2 {
-		names[0] = strings.TrimSuffix(names[1], ">")
+	arg.Cc = append([]string{}, arg.Cc...)
+	arg.Bcc = append([]string{}, arg.Bcc...)
+	if arg.Window == 0 {
+		arg.Window = 60000
+	}
+	if arg.Count == 0 {
+		arg.Count = 100
+	}
+	if arg.Retries == 0 {
+		arg.Retries = 3
+	}
+	if arg.Backoff <= 0 {
+		arg.Backoff = 1000
+	}
+	if arg.MaxBackoff <= 0 {
+		arg.MaxBackoff = 60000
+	}
+	s := &Smtp{
+		arg:    arg,
+		index:  map[string]*entry{},
+		queue:  make(chan item, 16),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
 	}
-	auth := smtp.PlainAuth(arg.Identity, names[0], arg.Password, strings.Split(arg.Host, ":")[0])
-	return &Smtp{arg, auth}
+	host := arg.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if s.auth, s.setup = newAuth(arg, host); s.setup == nil {
+		s.tls, s.setup = newTLSConfig(arg, host)
+	}
+	if s.setup == nil && strings.Contains(arg.Subject, "{{") {
+		s.subject, s.setup = template.New("subject").Parse(arg.Subject)
+	}
+	if s.host, _ = os.Hostname(); len(s.host) == 0 {
+		s.host = "localhost"
+	}
+	s.deliver = s.send
+	go s.loop()
+	return s
 }
 
+// Rotate sends the batch, it is the flush boundary of log.Rotate.
 func (s *Smtp) Rotate(begin, now time.Time) {
+	s.mu.Lock()
+	b := s.flush()
+	s.mu.Unlock()
+	s.enqueue(b, false)
 }
 
+// Write adds a record to the batch, identical records are merged with a repeat count.
+// The empty write of end-of-record is ignored. Write returns ErrClosed after Close.
 func (s *Smtp) Write(b []byte) (n int, err error) {
-	header := fmt.Sprintf(
-		"Subject: %s\r\nFrom: %s\r\nTo: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n",
-		s.arg.Subject, s.arg.Username, strings.Join(s.arg.To, ";"))
-
-	err = smtp.SendMail(
-		s.arg.Host,
-		s.auth,
-		s.arg.Username,
-		s.arg.To,
-		append([]byte(header), b...),
-	)
-
 	n = len(b)
+	line := strings.TrimRight(string(b), "\r\n")
+	if len(line) == 0 {
+		return
+	}
+
+	now := time.Now()
+	rec, key := parse(line)
+
+	s.mu.Lock()
+	if s.closed() {
+		s.mu.Unlock()
+		return 0, log.ErrClosed
+	}
+	e := s.index[key]
+	if e == nil {
+		e = &entry{key: key, line: line, first: now, rec: rec}
+		s.index[key] = e
+		s.entries = append(s.entries, e)
+	}
+	e.count++
+	e.last = now
+	s.records++
+	if len(s.arg.Attachment) != 0 {
+		s.lines = append(s.lines, line)
+	}
+
+	var full *batch
+	if s.arg.Count > 0 && s.records >= s.arg.Count {
+		full = s.flush()
+	} else if s.timer == nil && s.arg.Window > 0 {
+		s.timer = time.AfterFunc(time.Duration(s.arg.Window)*time.Millisecond, s.tick)
+	}
+	s.mu.Unlock()
+	s.enqueue(full, false)
 	return
 }
 
+func (s *Smtp) tick() {
+	s.mu.Lock()
+	s.timer = nil
+	b := s.flush()
+	s.mu.Unlock()
+	s.enqueue(b, false)
+}
+
+// Flush sends the batch and waits until the queued messages are delivered or spooled.
+// It returns the first delivery error since the last Flush.
+func (s *Smtp) Flush() error {
+	s.mu.Lock()
+	if s.closed() {
+		s.mu.Unlock()
+		return log.ErrClosed
+	}
+	b := s.flush()
+	s.mu.Unlock()
+	s.enqueue(b, true)
+	return s.wait()
+}
+
+// Close sends the batch, waits for the queued messages and closes the connection.
 func (s *Smtp) Close() (err error) {
+	err = log.ErrClosed
+	s.once.Do(func() {
+		s.mu.Lock()
+		b := s.flush()
+		s.mu.Unlock()
+		s.enqueue(b, true)
+		err = s.wait()
+
+		s.mu.Lock()
+		close(s.done)
+		s.mu.Unlock()
+		s.queued.Wait()
+		<-s.exited
+		s.drain()
+
+		s.cmu.Lock()
+		if s.idle != nil {
+			s.idle.Stop()
+		}
+		s.closeClient(true)
+		s.cmu.Unlock()
+	})
 	return
 }
+
+// batch is the records taken by flush.
+type batch struct {
+	entries []*entry
+	records int
+	lines   []string
+}
+
+// flush takes the batch to be sent by enqueue, s.mu must be locked.
+// The returned batch is nil if there is nothing to send.
+func (s *Smtp) flush() *batch {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if len(s.entries) == 0 || s.closed() {
+		return nil
+	}
+	b := &batch{s.entries, s.records, s.lines}
+	s.entries, s.index, s.records, s.lines = nil, map[string]*entry{}, 0, nil
+	s.queued.Add(1)
+	return b
+}
+
+// enqueue queues the batch b as one email, s.mu must not be locked.
+// If block is false and the queue is full, e.g. the relay is down,
+// the email is spooled or dropped instead of blocking the writer.
+func (s *Smtp) enqueue(b *batch, block bool) {
+	if b == nil {
+		return
+	}
+	defer s.queued.Done()
+	it := item{msg: s.message(s.summary(b.entries, b.records), b.entries, b.lines)}
+	if block {
+		select {
+		case s.queue <- it:
+		case <-s.done:
+			s.overflow(it.msg)
+		}
+		return
+	}
+	select {
+	case s.queue <- it:
+	default:
+		s.overflow(it.msg)
+	}
+}
+
+// summary returns the subject executed with Summary of entries.
+func (s *Smtp) summary(entries []*entry, records int) string {
+	if s.subject == nil {
+		return s.arg.Subject
+	}
+	sum := Summary{Level: log.LevelName(log.LZero), Host: s.host, Count: records}
+	level := log.LZero
+	for _, e := range entries {
+		if e.rec != nil && e.rec.Level < log.LZero && (level == log.LZero || e.rec.Level > level) {
+			level = e.rec.Level
+			sum.Level = log.LevelName(level)
+		}
+	}
+	var buf bytes.Buffer
+	if s.subject.Execute(&buf, sum) != nil {
+		return s.arg.Subject
+	}
+	return buf.String()
+}
+
+// recipients returns the envelope addresses of To, Cc and Bcc.
+func (s *Smtp) recipients() []string {
+	var rcpt []string
+	for _, list := range [][]string{s.arg.To, s.arg.Cc, s.arg.Bcc} {
+		for _, a := range list {
+			if len(a) != 0 {
+				rcpt = append(rcpt, address(a))
+			}
+		}
+	}
+	return rcpt
+}
+
+// parse returns the parsed record and the record without time and caller,
+// the latter is used to merge identical records.
+func parse(line string) (*log.Record, string) {
+	r, err := log.Parse(line)
+	if err != nil {
+		return nil, line
+	}
+	key := *r
+	key.Flags = 0
+	return r, string(log.TextEncoder.Encode(nil, &key))
+}
+
+// digest returns the text of entries, one record per line.
+func digest(entries []*entry) []byte {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.WriteString(e.line)
+		if e.count > 1 {
+			fmt.Fprintf(&buf, " (repeated %d times, last at %s)",
+				e.count, e.last.Format("2006-01-02 15:04:05"))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
@@ -1,7 +1,17 @@
 package smtp
 
 import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/typepress/log"
 )
 
 func TestSmtp(t *testing.T) {
@@ -26,3 +36,172 @@ func TestSmtp(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestBatch(t *testing.T) {
+	var subjects, bodies []string
+	s := New(Sets{Subject: "alert ({{.Count}} records)", Window: -1, Count: 4})
+	s.deliver = func(msg []byte) error {
+		m := parseMessage(t, msg)
+		subjects = append(subjects, m.subject)
+		bodies = append(bodies, m.text)
+		return nil
+	}
+
+	w := log.New(s, "", log.LstdFlags)
+	w.Alert("disk full")
+	w.Alert("disk full")
+	w.Error("disk full")
+	s.wait()
+	if len(bodies) != 0 {
+		t.Fatal("sent before the batch is full")
+	}
+	w.Alert("disk full")
+	s.wait()
+	if len(bodies) != 1 || subjects[0] != "alert (4 records)" {
+		t.Fatalf("want one digest, but got: %q", subjects)
+	}
+	lines := strings.Split(bodies[0], "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "(repeated 3 times, last at ") ||
+		!strings.HasPrefix(lines[1], "[E] ") {
+		t.Errorf("unexpected digest: %q", bodies[0])
+	}
+
+	w.Info("info")
+	s.Rotate(time.Now(), time.Now())
+	s.wait()
+	if len(bodies) != 2 || subjects[1] != "alert (1 records)" || !strings.HasSuffix(bodies[1], "\"info\"\n") {
+		t.Errorf("Rotate does not flush: %q", bodies)
+	}
+	if err := s.Close(); err != nil || len(bodies) != 2 {
+		t.Error("Close sends the empty batch")
+	}
+}
+
+type message struct {
+	header                 mail.Header
+	subject                string
+	text, html, attachment string
+}
+
+// parseMessage returns the decoded headers and parts of msg.
+func parseMessage(t *testing.T, msg []byte) (m message) {
+	mm, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.header = mm.Header
+	m.subject, err = new(mime.WordDecoder).DecodeHeader(mm.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.readParts(t, mm.Header.Get("Content-Type"), mm.Body)
+	return
+}
+
+func (m *message) readParts(t *testing.T, contentType string, body io.Reader) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct := p.Header.Get("Content-Type")
+		if strings.HasPrefix(ct, "multipart/") {
+			m.readParts(t, ct, p)
+			continue
+		}
+		var src io.Reader = p // quoted-printable is decoded by NextPart
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			src = base64.NewDecoder(base64.StdEncoding, p)
+		}
+		b, err := io.ReadAll(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+		switch {
+		case len(p.FileName()) != 0:
+			m.attachment = string(b)
+		case strings.HasPrefix(ct, "text/html"):
+			m.html = string(b)
+		default:
+			m.text = string(b)
+		}
+	}
+}
+
+func TestMIME(t *testing.T) {
+	var m message
+	s := New(Sets{
+		Username:   "日志 <log@example.com>",
+		To:         []string{"a@example.com", "b <b@example.com>"},
+		Cc:         []string{"c@example.com"},
+		Bcc:        []string{"d@example.com"},
+		Subject:    "[{{.Level}}] {{.Host}} 告警",
+		Attachment: "batch.log",
+		Window:     -1, Count: -1,
+	})
+	s.deliver = func(msg []byte) error {
+		m = parseMessage(t, msg)
+		return nil
+	}
+	if rcpt := s.recipients(); strings.Join(rcpt, ",") != "a@example.com,b@example.com,c@example.com,d@example.com" {
+		t.Errorf("unexpected recipients: %q", rcpt)
+	}
+
+	w := log.New(s, "", 0)
+	w.Error("<b>x</b>", 1)
+	w.Alert("中文")
+	w.Alert("中文")
+	s.Close()
+
+	if want := "[alert] " + s.host + " 告警"; m.subject != want {
+		t.Errorf("want subject %q, but got %q", want, m.subject)
+	}
+	if got := m.header.Get("To"); got != `<a@example.com>, "b" <b@example.com>` {
+		t.Errorf("unexpected To: %q", got)
+	}
+	if m.header.Get("Cc") != "<c@example.com>" || m.header.Get("Bcc") != "" {
+		t.Error("unexpected Cc or Bcc")
+	}
+	if from, err := m.header.AddressList("From"); err != nil || from[0].Name != "日志" {
+		t.Errorf("unexpected From: %v %v", from, err)
+	}
+	if _, err := m.header.Date(); err != nil || len(m.header.Get("Message-ID")) == 0 {
+		t.Error("missing Date or Message-ID")
+	}
+	if !strings.Contains(m.text, `[A] "中文" (repeated 2 times`) {
+		t.Errorf("unexpected text: %q", m.text)
+	}
+	if !strings.Contains(m.html, "<td>&lt;b&gt;x&lt;/b&gt;1</td>") || !strings.Contains(m.html, "<td>2</td>") {
+		t.Errorf("unexpected html: %q", m.html)
+	}
+	if m.attachment != "[E] \"<b>x</b>1\"\n[A] \"中文\"\n[A] \"中文\"\n" {
+		t.Errorf("unexpected attachment: %q", m.attachment)
+	}
+}
+
+func TestSubject(t *testing.T) {
+	s := New(Sets{Subject: "100% {alert}", Window: -1})
+	if got := s.summary(nil, 1); got != "100% {alert}" {
+		t.Errorf("want the plain subject, but got %q", got)
+	}
+	s.Close()
+
+	var failures []error
+	s = New(Sets{Subject: "[{{.Level}] alert", Count: 1, Retries: -1, OnFailure: func(err error, msg []byte) {
+		failures = append(failures, err)
+	}})
+	s.Write([]byte("x\n"))
+	if err := s.Flush(); err == nil || len(failures) != 1 || failures[0] != err {
+		t.Errorf("want the error of the malformed template, but got %v %v", err, failures)
+	}
+	s.Close()
+}
@@ -0,0 +1,181 @@
+package smtp
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is the delivery counters of Smtp.
+type Stats struct {
+	Sent    uint64 // the delivered messages, including the re-sent
+	Retried uint64 // the retries
+	Failed  uint64 // the messages failed after retries
+	Spooled uint64 // the messages saved to the spool directory
+	Resent  uint64 // the spooled messages delivered
+	Dropped uint64 // the messages dropped because the queue is full and not spooled
+}
+
+// Stats returns the delivery counters.
+func (s *Smtp) Stats() Stats {
+	return Stats{
+		Sent:    atomic.LoadUint64(&s.stats.Sent),
+		Retried: atomic.LoadUint64(&s.stats.Retried),
+		Failed:  atomic.LoadUint64(&s.stats.Failed),
+		Spooled: atomic.LoadUint64(&s.stats.Spooled),
+		Resent:  atomic.LoadUint64(&s.stats.Resent),
+		Dropped: atomic.LoadUint64(&s.stats.Dropped),
+	}
+}
+
+type item struct {
+	msg   []byte
+	flush chan error // not nil for flush marker
+}
+
+func (s *Smtp) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// loop is the sender goroutine.
+func (s *Smtp) loop() {
+	defer close(s.exited)
+	for {
+		select {
+		case it := <-s.queue:
+			s.handle(it)
+		case <-s.done:
+			for {
+				select {
+				case it := <-s.queue:
+					s.handle(it)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Smtp) handle(it item) {
+	if it.flush != nil {
+		it.flush <- s.err
+		s.err = nil
+		return
+	}
+	err := s.retry(it.msg)
+	if err == nil {
+		atomic.AddUint64(&s.stats.Sent, 1)
+		s.resend()
+		return
+	}
+
+	atomic.AddUint64(&s.stats.Failed, 1)
+	if s.err == nil {
+		s.err = err
+	}
+	if len(s.arg.Spool) != 0 && s.spool(it.msg) == nil {
+		atomic.AddUint64(&s.stats.Spooled, 1)
+	}
+	if s.arg.OnFailure != nil {
+		s.arg.OnFailure(err, it.msg)
+	}
+}
+
+// overflow spools msg which can not be queued, or drops it if there is no Spool.
+func (s *Smtp) overflow(msg []byte) {
+	if len(s.arg.Spool) != 0 && s.spool(msg) == nil {
+		atomic.AddUint64(&s.stats.Spooled, 1)
+		return
+	}
+	atomic.AddUint64(&s.stats.Dropped, 1)
+}
+
+// drain handles the messages queued after the sender goroutine exited.
+func (s *Smtp) drain() {
+	for {
+		select {
+		case it := <-s.queue:
+			s.handle(it)
+		default:
+			return
+		}
+	}
+}
+
+// wait waits until the messages queued before are handled.
+func (s *Smtp) wait() error {
+	marker := item{flush: make(chan error, 1)}
+	select {
+	case s.queue <- marker:
+	case <-s.done:
+		return nil
+	}
+	return <-marker.flush
+}
+
+// retry delivers msg with exponential backoff, the backoff is skipped after Close.
+func (s *Smtp) retry(msg []byte) (err error) {
+	backoff := time.Duration(s.arg.Backoff) * time.Millisecond
+	max := time.Duration(s.arg.MaxBackoff) * time.Millisecond
+	for i := 0; ; i++ {
+		if err = s.deliver(msg); err == nil || i >= s.arg.Retries {
+			return
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-s.done:
+			timer.Stop()
+			return
+		}
+		atomic.AddUint64(&s.stats.Retried, 1)
+		if backoff *= 2; backoff > max {
+			backoff = max
+		}
+	}
+}
+
+// spool saves msg to the spool directory, the temporary file is renamed when it is complete.
+func (s *Smtp) spool(msg []byte) error {
+	if err := os.MkdirAll(s.arg.Spool, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(s.arg.Spool, strconv.FormatInt(time.Now().UnixNano(), 10)+".eml")
+	if err := os.WriteFile(name+".tmp", msg, 0600); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// resend delivers the spooled messages in order, stops at the first failure.
+func (s *Smtp) resend() {
+	if len(s.arg.Spool) == 0 {
+		return
+	}
+	names, _ := filepath.Glob(filepath.Join(s.arg.Spool, "*.eml"))
+	sort.Strings(names)
+	for _, name := range names {
+		if s.closed() {
+			return
+		}
+		msg, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		if s.deliver(msg) != nil {
+			return
+		}
+		os.Remove(name)
+		atomic.AddUint64(&s.stats.Sent, 1)
+		atomic.AddUint64(&s.stats.Resent, 1)
+	}
+}
@@ -0,0 +1,140 @@
+package log
+
+import (
+	"errors"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type vrule struct {
+	pattern string
+	elems   int  // the number of path elements of pattern
+	ext     bool // pattern has the ".go" extension
+	level   int
+}
+
+type vmodule struct {
+	rules    []vrule
+	min, max int      // the lowest and highest level of rules
+	cache    sync.Map // uintptr PC -> int level, 0 for no rule
+}
+
+var vmodules atomic.Value // *vmodule
+
+// +dl zh-cn
+/*
+  SetVModule 设置按调用者源文件过滤的规则, 规则以逗号分隔, 格式为 "pattern=level":
+
+	db/*=debug,http/server.go=notify,main=error
+
+  pattern 按 path.Match 匹配调用者文件路径末尾相同数量的元素,
+  不含 ".go" 后缀的 pattern 匹配去掉 ".go" 后的文件名. level 是 ParseLevel 接受的名称.
+  按顺序第一个匹配的规则的 level 作为该调用位置的最小输出级别, 替代 Logger 的级别设置.
+  没有规则匹配的调用位置仍然使用 Logger 的级别. 规则作用于所有 Logger 的 Output.
+  每个调用位置的匹配结果被缓存. spec 为空时清除全部规则, 此时不再有额外开销.
+*/
+// +dl
+
+// SetVModule sets the per-file level rules, such as "db/*=debug,http/server.go=notify".
+// The level of the first rule matches the caller file replaces the level of Logger.
+// The empty spec removes all rules.
+func SetVModule(spec string) error {
+	var rules []vrule
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			continue
+		}
+		i := strings.LastIndexByte(s, '=')
+		if i <= 0 {
+			return errors.New("log: invalid vmodule rule " + s)
+		}
+		pattern := strings.Trim(strings.TrimSpace(s[:i]), "/")
+		if _, err := path.Match(pattern, ""); err != nil || len(pattern) == 0 {
+			return errors.New("log: invalid vmodule pattern " + s)
+		}
+		level, err := ParseLevel(strings.TrimSpace(s[i+1:]))
+		if err != nil || level == LZero {
+			return errors.New("log: invalid vmodule level " + s)
+		}
+		rules = append(rules, vrule{
+			pattern: pattern,
+			elems:   strings.Count(pattern, "/") + 1,
+			ext:     strings.HasSuffix(pattern, ".go"),
+			level:   level,
+		})
+	}
+	if len(rules) == 0 {
+		vmodules.Store((*vmodule)(nil))
+	} else {
+		v := &vmodule{rules: rules, min: rules[0].level, max: rules[0].level}
+		for _, r := range rules {
+			if r.level < v.min {
+				v.min = r.level
+			}
+			if r.level > v.max {
+				v.max = r.level
+			}
+		}
+		vmodules.Store(v)
+	}
+	return nil
+}
+
+// vmoduleLevel returns the level of the rule matches the call site pc.
+func vmoduleLevel(pc uintptr) (int, bool) {
+	v, _ := vmodules.Load().(*vmodule)
+	if v == nil || pc == 0 {
+		return 0, false
+	}
+	if level, ok := v.cache.Load(pc); ok {
+		return level.(int), level.(int) != 0
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	level := v.match(frame.File)
+	v.cache.Store(pc, level)
+	return level, level != 0
+}
+
+// callerLevel returns the level of the rule matches the caller, skip is the same as runtime.Caller.
+func callerLevel(skip int) (int, bool) {
+	if v, _ := vmodules.Load().(*vmodule); v == nil {
+		return 0, false
+	}
+	var pcs [1]uintptr
+	// runtime.Callers, callerLevel
+	if runtime.Callers(skip+2, pcs[:]) == 0 {
+		return 0, false
+	}
+	return vmoduleLevel(pcs[0])
+}
+
+func (v *vmodule) match(file string) int {
+	noext := strings.TrimSuffix(file, ".go")
+	for _, r := range v.rules {
+		name := noext
+		if r.ext {
+			name = file
+		}
+		if ok, _ := path.Match(r.pattern, lastElems(name, r.elems)); ok {
+			return r.level
+		}
+	}
+	return 0
+}
+
+// lastElems returns the last n elements of the slash-separated name.
+func lastElems(name string, n int) string {
+	for i := len(name) - 1; i >= 0; i-- {
+		if name[i] == '/' {
+			n--
+			if n == 0 {
+				return name[i+1:]
+			}
+		}
+	}
+	return name
+}
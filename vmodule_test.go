@@ -0,0 +1,84 @@
+package log
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVModule(t *testing.T) {
+	defer SetVModule("")
+	w := bytes.NewBuffer(nil)
+	l := New(w, "", 0, LError)
+
+	for _, spec := range []string{"x", "=debug", "x=nolevel", "[=debug"} {
+		if SetVModule(spec) == nil {
+			t.Errorf("want error for %q", spec)
+		}
+	}
+
+	if err := SetVModule("other.go=fatal, */vmodule_test=debug"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ { // the second time is cached
+		l.Debug("debug")
+		check(t, w, `[D] "debug"`)
+	}
+
+	if err := SetVModule("*.go=alert"); err != nil {
+		t.Fatal(err)
+	}
+	l.Error("error")
+	check(t, w, "")
+	l.Alert("alert")
+	check(t, w, `[A] "alert"`)
+
+	SetVModule("")
+	l.Debug("debug")
+	check(t, w, "")
+	l.Error("error")
+	check(t, w, `[E] "error"`)
+}
+
+func TestLastElems(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		n    int
+		want string
+	}{
+		{"/a/b/c.go", 1, "c.go"},
+		{"/a/b/c.go", 2, "b/c.go"},
+		{"/a/b/c.go", 4, "/a/b/c.go"},
+		{"c.go", 2, "c.go"},
+	} {
+		if got := lastElems(c.name, c.n); got != c.want {
+			t.Errorf("want %q, but got %q", c.want, got)
+		}
+	}
+}
+
+// The disabled calls do not allocate, the *logger is used because the
+// arguments always escape through the Logger interface.
+func TestDisabledAllocs(t *testing.T) {
+	defer SetVModule("")
+	l := New(bytes.NewBuffer(nil), "", 0, LError).(*logger)
+	for _, spec := range []string{"", "other.go=debug", "other.go=notify"} {
+		SetVModule(spec)
+		if n := testing.AllocsPerRun(100, func() { l.Debugf("%s %d", "debug", 1) }); n != 0 {
+			t.Errorf("vmodule %q: want 0 allocs, but got %v", spec, n)
+		}
+	}
+}
+
+func BenchmarkDebugDisabled(b *testing.B) {
+	defer SetVModule("")
+	l := New(bytes.NewBuffer(nil), "", 0, LError).(*logger)
+	for _, spec := range []string{"", "other.go=debug", "other.go=notify"} {
+		SetVModule(spec)
+		b.Run("vmodule="+spec, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				l.Debugf("%s %d", "debug", 1)
+			}
+		})
+	}
+}